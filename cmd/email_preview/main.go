@@ -0,0 +1,96 @@
+// Command email_preview renders every email in every locale with sample data
+// and writes the results to disk, so template changes can be checked in a
+// browser without sending anything.
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+	"masterboxer.com/project-micro-journal/templates"
+)
+
+func main() {
+	out := flag.String("out", "email-preview", "directory to write the rendered emails to")
+	dir := flag.String("dir", "", "read templates from this directory instead of the embedded copy, e.g. ./templates")
+	baseURL := flag.String("base-url", services.PublicBaseURLFromEnv(), "public base URL used for links")
+	flag.Parse()
+
+	var fsys fs.FS = templates.Email
+	if *dir != "" {
+		fsys = os.DirFS(*dir)
+	}
+
+	renderer, err := services.NewEmailRenderer(fsys, *baseURL)
+	if err != nil {
+		log.Fatal("EmailPreview: failed to load templates:", err)
+	}
+
+	samples := sampleData(*baseURL)
+	for _, locale := range renderer.Locales() {
+		if err := os.MkdirAll(filepath.Join(*out, locale), 0o755); err != nil {
+			log.Fatal("EmailPreview:", err)
+		}
+
+		for _, name := range renderer.Names() {
+			email, err := renderer.Render(name, locale, samples[name])
+			if err != nil {
+				log.Fatalf("EmailPreview: %s/%s: %v", locale, name, err)
+			}
+
+			base := filepath.Join(*out, locale, name)
+			if err := os.WriteFile(base+".html", []byte(email.HTML), 0o644); err != nil {
+				log.Fatal("EmailPreview:", err)
+			}
+			if err := os.WriteFile(base+".txt", []byte(email.Text), 0o644); err != nil {
+				log.Fatal("EmailPreview:", err)
+			}
+			log.Printf("%-5s %-20s %s", locale, name, email.Subject)
+		}
+	}
+
+	log.Println("✅ Previews written to", *out)
+}
+
+func sampleData(baseURL string) map[string]interface{} {
+	weekStart := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	unsubscribe := baseURL + "/email/unsubscribe?token=preview"
+
+	return map[string]interface{}{
+		"reset-password": map[string]interface{}{
+			"Link":             baseURL + "/reset-password?token=preview",
+			"ExpiresInMinutes": 15,
+		},
+		"verify-email": map[string]interface{}{
+			"Link": baseURL + "/verify-email?token=preview",
+		},
+		"notification-email": map[string]interface{}{
+			"Title":          "New comment",
+			"Body":           "Asha commented on your entry: \"Loved this one!\"",
+			"Type":           "post_comment",
+			"UnsubscribeURL": unsubscribe,
+		},
+		"weekly-digest": map[string]interface{}{
+			"DisplayName":         "Asha",
+			"WeekStart":           weekStart,
+			"WeekEnd":             weekStart.AddDate(0, 0, 6),
+			"PostCount":           5,
+			"ReactionCount":       12,
+			"CommentCount":        3,
+			"Score":               142,
+			"ScoreChange":         8,
+			"HasScoreChange":      true,
+			"ConnectionPostCount": 9,
+			"ActiveConnections": []map[string]interface{}{
+				{"DisplayName": "Ravi", "PostCount": 6},
+				{"DisplayName": "Meera", "PostCount": 3},
+			},
+			"UnsubscribeURL": unsubscribe,
+		},
+	}
+}
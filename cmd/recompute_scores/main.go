@@ -0,0 +1,37 @@
+// Command recompute_scores rebuilds Reflecto scores from the score ledger,
+// fixing any user whose stored score has drifted from it.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"masterboxer.com/project-micro-journal/database"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func main() {
+	userID := flag.Int("user", 0, "only recompute this user (default: everyone)")
+	dryRun := flag.Bool("dry-run", false, "report drifted scores without fixing them")
+	flag.Parse()
+
+	db, err := database.ConnectDB()
+	if err != nil {
+		log.Fatal("RecomputeScores: DB connection failed:", err)
+	}
+	defer db.Close()
+
+	drifts, err := handlers.RecomputeReflectoScores(db, *userID, *dryRun)
+	for _, d := range drifts {
+		log.Printf("user %d: stored %d, ledger %d", d.UserID, d.Stored, d.Derived)
+	}
+	if err != nil {
+		log.Fatal("RecomputeScores: ", err)
+	}
+
+	if *dryRun {
+		log.Printf("🔎 %d score(s) drifted from the ledger", len(drifts))
+		return
+	}
+	log.Printf("✅ Recomputed %d score(s)", len(drifts))
+}
@@ -0,0 +1,126 @@
+// Command scheduler runs the background jobs (reminders, score decay, the
+// weekly digest, cleanup) on their schedules. Run it with -run <job> to run a
+// single job once and exit, or -list to print the jobs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"masterboxer.com/project-micro-journal/database"
+	"masterboxer.com/project-micro-journal/handlers"
+	"masterboxer.com/project-micro-journal/scheduler"
+	"masterboxer.com/project-micro-journal/services"
+)
+
+func main() {
+	runOnce := flag.String("run", "", "run this job once and exit")
+	list := flag.Bool("list", false, "list the jobs and their next run times")
+	flag.Parse()
+
+	// Without Firebase credentials FCM is disabled, but the other jobs and
+	// push providers still run.
+	firebasePath := os.Getenv("FIREBASE_CREDENTIALS_PATH")
+	if firebasePath == "" {
+		log.Println("Warning: FIREBASE_CREDENTIALS_PATH not set")
+	}
+
+	db, err := database.ConnectDB()
+	if err != nil {
+		log.Fatal("Scheduler: DB connection failed:", err)
+	}
+	defer db.Close()
+
+	push := services.NewPushSenderFromEnv(context.Background(), firebasePath)
+
+	mailSvc, err := services.NewMailService(services.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Scheduler: Mail service init failed:", err)
+	}
+
+	s := scheduler.New(db)
+
+	// Reminders are claimed per user when due, so polling every minute sends
+	// each one close to the user's chosen time and never twice.
+	s.Register(scheduler.Job{
+		Name:     "daily_reminder",
+		Schedule: scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			return handlers.SendDailyReminderNotifications(ctx, db, push)
+		},
+	})
+	s.Register(scheduler.Job{
+		Name:     "score_decay_warning",
+		Schedule: scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			return handlers.SendScoreDecayNotifications(ctx, db, push)
+		},
+	})
+	s.Register(scheduler.Job{
+		Name:     "memories",
+		Schedule: scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			return handlers.SendMemoriesNotifications(ctx, db, push)
+		},
+	})
+	s.Register(scheduler.Job{
+		Name:     "deferred_pushes",
+		Schedule: scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			return handlers.FlushDeferredPushes(ctx, db, push)
+		},
+	})
+	// Journal days end at local noon, on the quarter hour in every timezone.
+	s.Register(scheduler.Job{
+		Name:     "score_decay",
+		Schedule: scheduler.Every(15 * time.Minute),
+		Run: func(ctx context.Context) error {
+			return handlers.ApplyDailyDecay(ctx, db)
+		},
+	})
+	s.Register(scheduler.Job{
+		Name:     "weekly_digest",
+		Schedule: scheduler.Weekly(time.Monday, 8, 0),
+		Timeout:  2 * time.Hour,
+		Run: func(ctx context.Context) error {
+			return handlers.SendWeeklyDigests(ctx, db, mailSvc)
+		},
+	})
+	s.Register(scheduler.Job{
+		Name:     "cleanup",
+		Schedule: scheduler.Daily(3, 30),
+		Run: func(ctx context.Context) error {
+			return handlers.CleanupExpiredRecords(ctx, db)
+		},
+	})
+
+	if *list {
+		for _, job := range s.Jobs() {
+			fmt.Printf("%-20s next run %s\n", job.Name, job.Schedule.Next(time.Now()).Format(time.RFC3339))
+		}
+		return
+	}
+
+	if *runOnce != "" {
+		if err := s.RunNow(*runOnce); err != nil {
+			log.Fatalf("Scheduler: %s failed: %v", *runOnce, err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.Start(ctx)
+	log.Println("⏰ Scheduler running")
+
+	<-ctx.Done()
+	log.Println("Shutting down scheduler, waiting for running jobs...")
+	s.Stop()
+}
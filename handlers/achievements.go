@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+const achievementNotificationType = "achievement"
+
+// Metrics achievements can be defined on; achievementStats measures them.
+const (
+	metricPosts             = "posts"
+	metricLongestStreak     = "longest_streak"
+	metricTemplatesUsed     = "templates_used"
+	metricTemplatesTotal    = "templates_total"
+	metricReactionsReceived = "reactions_received"
+	metricChallenges        = "challenges_completed"
+)
+
+// achievement is unlocked once the user's Metric reaches Threshold, or the
+// value of ThresholdMetric when that is set.
+type achievement struct {
+	Key             string
+	Title           string
+	Description     string
+	Metric          string
+	Threshold       int
+	ThresholdMetric string
+}
+
+// achievements are every achievement that can be unlocked, in display order.
+// Keys are stored in user_achievements, so never rename one.
+var achievements = []achievement{
+	{Key: "first_entry", Title: "First entry", Description: "Wrote your first journal entry", Metric: metricPosts, Threshold: 1},
+	{Key: "streak_7", Title: "One week strong", Description: "Kept a 7-day streak", Metric: metricLongestStreak, Threshold: 7},
+	{Key: "streak_30", Title: "Month of reflection", Description: "Kept a 30-day streak", Metric: metricLongestStreak, Threshold: 30},
+	{Key: "streak_100", Title: "Centurion", Description: "Kept a 100-day streak", Metric: metricLongestStreak, Threshold: 100},
+	{Key: "streak_365", Title: "A year of days", Description: "Kept a 365-day streak", Metric: metricLongestStreak, Threshold: 365},
+	{Key: "every_template", Title: "Explorer", Description: "Wrote an entry with every template", Metric: metricTemplatesUsed, ThresholdMetric: metricTemplatesTotal},
+	{Key: "reactions_100", Title: "Crowd favourite", Description: "Received 100 reactions on your entries", Metric: metricReactionsReceived, Threshold: 100},
+	{Key: "challenge_1", Title: "Challenger", Description: "Completed a journaling challenge", Metric: metricChallenges, Threshold: 1},
+	{Key: "challenge_5", Title: "Up for anything", Description: "Completed 5 journaling challenges", Metric: metricChallenges, Threshold: 5},
+}
+
+// progress returns the user's value for a and the value that unlocks it.
+func (a achievement) progress(stats map[string]int) (int, int) {
+	target := a.Threshold
+	if a.ThresholdMetric != "" {
+		target = stats[a.ThresholdMetric]
+	}
+	return stats[a.Metric], target
+}
+
+func (a achievement) met(stats map[string]int) bool {
+	value, target := a.progress(stats)
+	return target > 0 && value >= target
+}
+
+type achievementsEvent struct {
+	UserID int `json:"user_id"`
+}
+
+// achievementStats measures every metric for a user, building their streak
+// first if they have no streaks row yet.
+func achievementStats(db *sql.DB, userID int) (map[string]int, error) {
+	var longestStreak sql.NullInt64
+	var posts, templatesUsed, templatesTotal, reactionsReceived, challenges int
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM posts WHERE user_id = $1),
+			(SELECT longest_streak FROM streaks WHERE user_id = $1),
+			(SELECT COUNT(DISTINCT p.template_id) FROM posts p
+			 JOIN templates t ON t.id = p.template_id
+			 WHERE p.user_id = $1),
+			(SELECT COUNT(*) FROM templates),
+			(SELECT COUNT(*) FROM reactions r
+			 JOIN posts p ON p.id = r.post_id
+			 WHERE p.user_id = $1 AND r.user_id <> $1),
+			(SELECT COUNT(*) FROM challenge_participants
+			 WHERE user_id = $1 AND completed_at IS NOT NULL)`,
+		userID).Scan(&posts, &longestStreak, &templatesUsed, &templatesTotal, &reactionsReceived, &challenges)
+	if err != nil {
+		return nil, err
+	}
+	if !longestStreak.Valid {
+		s, err := buildStreak(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		longestStreak.Int64 = int64(s.longest)
+	}
+
+	return map[string]int{
+		metricPosts:             posts,
+		metricLongestStreak:     int(longestStreak.Int64),
+		metricTemplatesUsed:     templatesUsed,
+		metricTemplatesTotal:    templatesTotal,
+		metricReactionsReceived: reactionsReceived,
+		metricChallenges:        challenges,
+	}, nil
+}
+
+// checkAchievements unlocks whatever the user has newly earned and notifies
+// them of every unlock not yet announced, so a retry after a failed
+// notification picks it up again.
+func checkAchievements(db *sql.DB, push services.PushSender, userID int) error {
+	stats, err := achievementStats(db, userID)
+	if err != nil {
+		return fmt.Errorf("achievement stats for user %d: %w", userID, err)
+	}
+
+	for _, a := range achievements {
+		if !a.met(stats) {
+			continue
+		}
+		_, err := db.Exec(`
+			INSERT INTO user_achievements (user_id, achievement_key)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, achievement_key) DO NOTHING`,
+			userID, a.Key)
+		if err != nil {
+			return fmt.Errorf("unlock %s for user %d: %w", a.Key, userID, err)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT achievement_key FROM user_achievements
+		WHERE user_id = $1 AND notified_at IS NULL`,
+		userID)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range pending {
+		a, ok := findAchievement(key)
+		if !ok {
+			continue
+		}
+		log.Printf("[Achievements] User %d unlocked %s", userID, key)
+
+		err := deliverNotification(db, push, notification{
+			UserID:     userID,
+			Type:       achievementNotificationType,
+			TargetType: achievementNotificationType,
+			Title:      "Achievement unlocked: " + a.Title,
+			Body:       a.Description,
+			Data: map[string]string{
+				"type":        achievementNotificationType,
+				"achievement": a.Key,
+				"user_id":     strconv.Itoa(userID),
+			},
+			DedupeKey: "achievement:" + a.Key,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			UPDATE user_achievements SET notified_at = NOW()
+			WHERE user_id = $1 AND achievement_key = $2`,
+			userID, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findAchievement(key string) (achievement, bool) {
+	for _, a := range achievements {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return achievement{}, false
+}
+
+type userAchievement struct {
+	Key         string     `json:"key"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Unlocked    bool       `json:"unlocked"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	// Progress and Target show how close a locked achievement is.
+	Progress int `json:"progress"`
+	Target   int `json:"target"`
+}
+
+// GetUserAchievements lists every achievement with whether and when the user
+// unlocked it.
+func GetUserAchievements(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+			http.Error(w, "Failed to fetch achievements", http.StatusInternalServerError)
+			log.Println("GetUserAchievements user error:", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT achievement_key, unlocked_at FROM user_achievements
+			WHERE user_id = $1`,
+			userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch achievements", http.StatusInternalServerError)
+			log.Println("GetUserAchievements query error:", err)
+			return
+		}
+		unlocked := make(map[string]time.Time)
+		for rows.Next() {
+			var key string
+			var at time.Time
+			if err := rows.Scan(&key, &at); err != nil {
+				rows.Close()
+				http.Error(w, "Failed to fetch achievements", http.StatusInternalServerError)
+				log.Println("GetUserAchievements scan error:", err)
+				return
+			}
+			unlocked[key] = at
+		}
+		rows.Close()
+
+		stats, err := achievementStats(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch achievements", http.StatusInternalServerError)
+			log.Println("GetUserAchievements stats error:", err)
+			return
+		}
+
+		list := make([]userAchievement, 0, len(achievements))
+		for _, a := range achievements {
+			ua := userAchievement{Key: a.Key, Title: a.Title, Description: a.Description}
+			ua.Progress, ua.Target = a.progress(stats)
+			ua.Progress = min(ua.Progress, ua.Target)
+			if at, ok := unlocked[a.Key]; ok {
+				ua.Unlocked = true
+				ua.UnlockedAt = &at
+				ua.Progress = ua.Target
+			}
+			list = append(list, ua)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
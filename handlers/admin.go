@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/models"
+)
+
+var mailStatuses = map[string]bool{
+	"pending": true,
+	"sending": true,
+	"sent":    true,
+	"failed":  true,
+	"bounced": true,
+}
+
+// RequireAdmin only lets through requests whose X-Admin-Key header matches
+// ADMIN_API_KEY. With no key configured the admin API is disabled.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := os.Getenv("ADMIN_API_KEY")
+		if key == "" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(key)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetMailQueue lists queued mail, newest first, optionally filtered by
+// status, e.g. ?status=bounced.
+func GetMailQueue(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status != "" && !mailStatuses[status] {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 500 {
+				http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+		}
+
+		rows, err := db.Query(`
+			SELECT id, template, recipient, subject, status, attempts, max_attempts,
+			       last_error, next_attempt_at, created_at, sent_at
+			FROM mail_queue
+			WHERE $1 = '' OR status = $1
+			ORDER BY id DESC
+			LIMIT $2`,
+			status, limit)
+		if err != nil {
+			http.Error(w, "Failed to fetch mail queue", http.StatusInternalServerError)
+			log.Println("GetMailQueue query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		entries := []models.MailQueueEntry{}
+		for rows.Next() {
+			var e models.MailQueueEntry
+			if err := rows.Scan(&e.ID, &e.Template, &e.Recipient, &e.Subject, &e.Status, &e.Attempts,
+				&e.MaxAttempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt, &e.SentAt); err != nil {
+				http.Error(w, "Failed to fetch mail queue", http.StatusInternalServerError)
+				log.Println("GetMailQueue scan error:", err)
+				return
+			}
+			entries = append(entries, e)
+		}
+
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// GetMailQueueStats counts queued mail by status.
+func GetMailQueueStats(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query(`SELECT status, COUNT(*) FROM mail_queue GROUP BY status`)
+		if err != nil {
+			http.Error(w, "Failed to fetch mail stats", http.StatusInternalServerError)
+			log.Println("GetMailQueueStats query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		counts := make(map[string]int, len(mailStatuses))
+		for status := range mailStatuses {
+			counts[status] = 0
+		}
+		for rows.Next() {
+			var status string
+			var count int
+			if err := rows.Scan(&status, &count); err != nil {
+				http.Error(w, "Failed to fetch mail stats", http.StatusInternalServerError)
+				log.Println("GetMailQueueStats scan error:", err)
+				return
+			}
+			counts[status] = count
+		}
+
+		json.NewEncoder(w).Encode(counts)
+	}
+}
+
+// RetryMail puts a failed or bounced email back in the queue with a fresh
+// set of attempts.
+func RetryMail(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid mail ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE mail_queue
+			SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+			WHERE id = $1 AND status IN ('failed', 'bounced')`,
+			id)
+		if err != nil {
+			http.Error(w, "Failed to retry mail", http.StatusInternalServerError)
+			log.Println("RetryMail error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "No failed or bounced mail with that ID", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Mail queued for retry"})
+	}
+}
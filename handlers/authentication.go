@@ -219,6 +219,38 @@ func verifyAccessToken(tokenString string) error {
 	return nil
 }
 
+// authenticatedUserID resolves the user behind the request's Bearer access
+// token. It backs the /users/me/... routes.
+func authenticatedUserID(db *sql.DB, r *http.Request) (int, error) {
+	var tokenString string
+	fmt.Sscanf(r.Header.Get("Authorization"), "Bearer %s", &tokenString)
+	if tokenString == "" {
+		return 0, fmt.Errorf("missing token")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return accessSecretKey, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, fmt.Errorf("invalid token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	email, ok := claims["email"].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid token claims")
+	}
+
+	var userID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE email = $1`, email).Scan(&userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
 func LoginHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var loginReq LoginRequest
@@ -391,7 +423,8 @@ func ForgotPasswordHandler(db *sql.DB, mailSvc *services.MailService) http.Handl
 		}
 
 		var userID int
-		err := db.QueryRow(`SELECT id FROM users WHERE email = $1`, req.Email).Scan(&userID)
+		var locale string
+		err := db.QueryRow(`SELECT id, locale FROM users WHERE email = $1`, req.Email).Scan(&userID, &locale)
 
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusOK)
@@ -404,23 +437,23 @@ func ForgotPasswordHandler(db *sql.DB, mailSvc *services.MailService) http.Handl
 			return
 		}
 
-		_, err = db.Exec(`DELETE FROM password_resets WHERE user_id = $1`, userID)
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
 
-		token := generateSecureToken()
-		expiresAt := time.Now().Add(15 * time.Minute)
-
-		err = mailSvc.SendPasswordResetEmail(req.Email, token)
+		_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = $1`, userID)
 		if err != nil {
-			fmt.Printf("[ForgotPassword] Failed to send reset email to %s: %v\n", req.Email, err)
-			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		_, err = db.Exec(`
+		token := generateSecureToken()
+		expiresAt := time.Now().Add(15 * time.Minute)
+
+		_, err = tx.Exec(`
 			INSERT INTO password_resets (user_id, token, expires_at)
 			VALUES ($1, $2, $3)
 		`, userID, token, expiresAt)
@@ -430,6 +463,17 @@ func ForgotPasswordHandler(db *sql.DB, mailSvc *services.MailService) http.Handl
 			return
 		}
 
+		if err := queueMail(tx, mailSvc, "", mailSvc.PasswordResetMail(req.Email, locale, token)); err != nil {
+			fmt.Printf("[ForgotPassword] Failed to queue reset email to %s: %v\n", req.Email, err)
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("If the email exists, a reset link has been sent"))
 	}
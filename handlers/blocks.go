@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type restrictedUserInfo struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Since       time.Time `json:"since"`
+}
+
+func BlockUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+
+		var req struct {
+			BlockedID int `json:"blocked_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.BlockedID == 0 || req.BlockedID == userID {
+			http.Error(w, "Cannot block this user", http.StatusBadRequest)
+			return
+		}
+
+		var targetExists bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`,
+			req.BlockedID).Scan(&targetExists)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error checking user: %v", err)
+			return
+		}
+		if !targetExists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// A block severs the relationship both ways, including pending requests.
+		_, err = tx.Exec(`
+			DELETE FROM followers
+			WHERE (follower_id = $1 AND following_id = $2)
+			   OR (follower_id = $2 AND following_id = $1)`,
+			userID, req.BlockedID)
+		if err != nil {
+			http.Error(w, "Failed to remove follows", http.StatusInternalServerError)
+			log.Println("BlockUser unfollow error:", err)
+			return
+		}
+
+		// Open pacts between the two end with it: invitations are cancelled
+		// and active pacts ended, so no shared streak outlives the block.
+		_, err = tx.Exec(`
+			UPDATE pacts
+			SET status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE 'ended' END,
+			    ended_at = NOW(),
+			    ended_by = $1
+			WHERE status IN ('pending', 'active')
+			  AND ((inviter_id = $1 AND invitee_id = $2)
+			    OR (inviter_id = $2 AND invitee_id = $1))`,
+			userID, req.BlockedID)
+		if err != nil {
+			http.Error(w, "Failed to end pacts", http.StatusInternalServerError)
+			log.Println("BlockUser pact error:", err)
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO user_blocks (blocker_id, blocked_id)
+			VALUES ($1, $2)
+			ON CONFLICT (blocker_id, blocked_id) DO NOTHING`,
+			userID, req.BlockedID)
+		if err != nil {
+			http.Error(w, "Failed to block user", http.StatusInternalServerError)
+			log.Println("BlockUser insert error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "User blocked",
+		})
+	}
+}
+
+func UnblockUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+		blockedID, _ := strconv.Atoi(vars["blocked_id"])
+
+		result, err := db.Exec(`
+			DELETE FROM user_blocks
+			WHERE blocker_id = $1 AND blocked_id = $2`,
+			userID, blockedID)
+		if err != nil {
+			http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+			log.Println("UnblockUser error:", err)
+			return
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "User unblocked",
+		})
+	}
+}
+
+func GetBlockedUsers(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+
+		rows, err := db.Query(`
+			SELECT u.id, u.username, u.display_name, b.created_at
+			FROM user_blocks b
+			JOIN users u ON b.blocked_id = u.id
+			WHERE b.blocker_id = $1
+			ORDER BY b.created_at DESC`,
+			userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch blocked users", http.StatusInternalServerError)
+			log.Println("GetBlockedUsers error:", err)
+			return
+		}
+		defer rows.Close()
+
+		blocked := []restrictedUserInfo{}
+		for rows.Next() {
+			var b restrictedUserInfo
+			if err := rows.Scan(&b.ID, &b.Username, &b.DisplayName, &b.Since); err != nil {
+				http.Error(w, "Error scanning blocked users", http.StatusInternalServerError)
+				return
+			}
+			blocked = append(blocked, b)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocked)
+	}
+}
+
+func MuteUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+
+		var req struct {
+			MutedID int `json:"muted_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.MutedID == 0 || req.MutedID == userID {
+			http.Error(w, "Cannot mute this user", http.StatusBadRequest)
+			return
+		}
+
+		_, err := db.Exec(`
+			INSERT INTO user_mutes (muter_id, muted_id)
+			SELECT $1, id FROM users WHERE id = $2
+			ON CONFLICT (muter_id, muted_id) DO NOTHING`,
+			userID, req.MutedID)
+		if err != nil {
+			http.Error(w, "Failed to mute user", http.StatusInternalServerError)
+			log.Println("MuteUser error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "User muted",
+		})
+	}
+}
+
+func UnmuteUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+		mutedID, _ := strconv.Atoi(vars["muted_id"])
+
+		result, err := db.Exec(`
+			DELETE FROM user_mutes
+			WHERE muter_id = $1 AND muted_id = $2`,
+			userID, mutedID)
+		if err != nil {
+			http.Error(w, "Failed to unmute user", http.StatusInternalServerError)
+			log.Println("UnmuteUser error:", err)
+			return
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Mute not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "User unmuted",
+		})
+	}
+}
+
+func GetMutedUsers(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, _ := strconv.Atoi(vars["user_id"])
+
+		rows, err := db.Query(`
+			SELECT u.id, u.username, u.display_name, m.created_at
+			FROM user_mutes m
+			JOIN users u ON m.muted_id = u.id
+			WHERE m.muter_id = $1
+			ORDER BY m.created_at DESC`,
+			userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch muted users", http.StatusInternalServerError)
+			log.Println("GetMutedUsers error:", err)
+			return
+		}
+		defer rows.Close()
+
+		muted := []restrictedUserInfo{}
+		for rows.Next() {
+			var m restrictedUserInfo
+			if err := rows.Scan(&m.ID, &m.Username, &m.DisplayName, &m.Since); err != nil {
+				http.Error(w, "Error scanning muted users", http.StatusInternalServerError)
+				return
+			}
+			muted = append(muted, m)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(muted)
+	}
+}
@@ -0,0 +1,625 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	challengeUpcoming = "upcoming"
+	challengeActive   = "active"
+	challengeEnded    = "ended"
+)
+
+type Challenge struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	TemplateID   int    `json:"template_id"`
+	TemplateName string `json:"template_name"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+	// RequiredDays of the TotalDays must have an entry to complete it.
+	RequiredDays     int        `json:"required_days"`
+	TotalDays        int        `json:"total_days"`
+	Status           string     `json:"status"`
+	ParticipantCount int        `json:"participant_count"`
+	Joined           bool       `json:"joined"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	startDate time.Time
+	endDate   time.Time
+}
+
+type challengeDay struct {
+	Date string `json:"date"`
+	Done bool   `json:"done"`
+}
+
+// challengeSelectSQL reads challenges along with whether the user bound to $1
+// has joined and completed them.
+const challengeSelectSQL = `
+	SELECT c.id, c.title, c.description, c.template_id, t.name, c.start_date, c.end_date,
+	       c.required_days, c.created_at,
+	       (SELECT COUNT(*) FROM challenge_participants cp WHERE cp.challenge_id = c.id),
+	       me.user_id IS NOT NULL, me.completed_at
+	FROM challenges c
+	JOIN templates t ON t.id = c.template_id
+	LEFT JOIN challenge_participants me ON me.challenge_id = c.id AND me.user_id = $1`
+
+// scanChallenge reads a challengeSelectSQL row; today is the viewer's journal
+// date, which decides the challenge's status.
+func scanChallenge(row interface{ Scan(...interface{}) error }, today time.Time) (Challenge, error) {
+	var c Challenge
+	var completedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.Title, &c.Description, &c.TemplateID, &c.TemplateName,
+		&c.startDate, &c.endDate, &c.RequiredDays, &c.CreatedAt,
+		&c.ParticipantCount, &c.Joined, &completedAt)
+	if err != nil {
+		return c, err
+	}
+
+	c.startDate = c.startDate.UTC()
+	c.endDate = c.endDate.UTC()
+	c.StartDate = c.startDate.Format("2006-01-02")
+	c.EndDate = c.endDate.Format("2006-01-02")
+	c.TotalDays = daysBetween(c.startDate, c.endDate) + 1
+	if completedAt.Valid {
+		c.CompletedAt = &completedAt.Time
+	}
+
+	switch {
+	case today.Before(c.startDate):
+		c.Status = challengeUpcoming
+	case today.After(c.endDate):
+		c.Status = challengeEnded
+	default:
+		c.Status = challengeActive
+	}
+	return c, nil
+}
+
+// userJournalToday is the user's current journal date, in UTC when their
+// timezone is unknown or invalid.
+func userJournalToday(q queryer, userID int) (time.Time, error) {
+	var timezone string
+	err := q.QueryRow(`SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = $1`, userID).Scan(&timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	today, err := ComputeJournalDate(time.Now().UTC(), timezone)
+	if err != nil {
+		today, _ = ComputeJournalDate(time.Now().UTC(), "UTC")
+	}
+	return today, nil
+}
+
+// completeChallenges marks every challenge the user has joined and now meets
+// as completed, and enqueues its score bonus. The bonus goes through score.add
+// like any other score change, deduplicated on its event key, which in turn
+// checks achievements. CreatePost and JoinChallenge call it in their
+// transaction; completion is never undone, even if entries are later deleted.
+func completeChallenges(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`
+		SELECT c.id
+		FROM challenge_participants cp
+		JOIN challenges c ON c.id = cp.challenge_id
+		WHERE cp.user_id = $1 AND cp.completed_at IS NULL
+		  AND (SELECT COUNT(DISTINCT p.journal_date) FROM posts p
+		       WHERE p.user_id = cp.user_id AND p.template_id = c.template_id
+		         AND p.journal_date BETWEEN c.start_date AND c.end_date) >= c.required_days
+		ORDER BY c.id
+		FOR UPDATE OF cp`,
+		userID)
+	if err != nil {
+		return err
+	}
+	var completed []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		completed = append(completed, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, challengeID := range completed {
+		_, err := tx.Exec(`
+			UPDATE challenge_participants SET completed_at = NOW()
+			WHERE challenge_id = $1 AND user_id = $2`,
+			challengeID, userID)
+		if err != nil {
+			return fmt.Errorf("challenge %d: %w", challengeID, err)
+		}
+
+		err = enqueueEvent(tx, eventScoreAdd, fmt.Sprintf("challenge:%d:%d", challengeID, userID), scoreEvent{
+			UserID: userID, Action: ActionChallenge,
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("[Challenges] User %d completed challenge %d", userID, challengeID)
+	}
+	return nil
+}
+
+// GetChallenges lists challenges with the authenticated user's part in each,
+// soonest ending first. ?status= is upcoming, active or ended; without it,
+// challenges that haven't ended are listed.
+func GetChallenges(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		var filter string
+		switch status {
+		case "":
+			filter = `WHERE c.end_date >= $2`
+		case challengeUpcoming:
+			filter = `WHERE c.start_date > $2`
+		case challengeActive:
+			filter = `WHERE $2 BETWEEN c.start_date AND c.end_date`
+		case challengeEnded:
+			filter = `WHERE c.end_date < $2`
+		default:
+			http.Error(w, "status must be upcoming, active or ended", http.StatusBadRequest)
+			return
+		}
+
+		today, err := userJournalToday(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch challenges", http.StatusInternalServerError)
+			log.Println("GetChallenges user error:", err)
+			return
+		}
+
+		order := `ORDER BY c.end_date, c.id`
+		if status == challengeEnded {
+			order = `ORDER BY c.end_date DESC, c.id DESC`
+		}
+		rows, err := db.Query(challengeSelectSQL+` `+filter+` `+order, userID, today)
+		if err != nil {
+			http.Error(w, "Failed to fetch challenges", http.StatusInternalServerError)
+			log.Println("GetChallenges query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		challenges := []Challenge{}
+		for rows.Next() {
+			c, err := scanChallenge(rows, today)
+			if err != nil {
+				http.Error(w, "Failed to fetch challenges", http.StatusInternalServerError)
+				log.Println("GetChallenges scan error:", err)
+				return
+			}
+			challenges = append(challenges, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenges)
+	}
+}
+
+// GetChallenge returns one challenge with the authenticated user's part in it.
+func GetChallenge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		challengeID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+			return
+		}
+
+		today, err := userJournalToday(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch challenge", http.StatusInternalServerError)
+			log.Println("GetChallenge user error:", err)
+			return
+		}
+		c, err := scanChallenge(db.QueryRow(challengeSelectSQL+` WHERE c.id = $2`, userID, challengeID), today)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Challenge not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch challenge", http.StatusInternalServerError)
+			log.Println("GetChallenge error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// CreateChallenge adds a challenge. Dates are journal dates (YYYY-MM-DD);
+// required_days defaults to every day from start_date to end_date.
+func CreateChallenge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Title        string `json:"title"`
+			Description  string `json:"description"`
+			TemplateID   int    `json:"template_id"`
+			StartDate    string `json:"start_date"`
+			EndDate      string `json:"end_date"`
+			RequiredDays int    `json:"required_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title == "" || len(req.Title) > 100 {
+			http.Error(w, "Title is required and must be at most 100 characters", http.StatusBadRequest)
+			return
+		}
+		if req.TemplateID == 0 {
+			http.Error(w, "template_id is required", http.StatusBadRequest)
+			return
+		}
+		start, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			http.Error(w, "start_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		end, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			http.Error(w, "end_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if end.Before(start) {
+			http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+			return
+		}
+		// Journal days trail UTC by up to a day, so allow yesterday's date.
+		if end.Before(time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)) {
+			http.Error(w, "end_date must not be in the past", http.StatusBadRequest)
+			return
+		}
+		totalDays := daysBetween(start, end) + 1
+		if req.RequiredDays == 0 {
+			req.RequiredDays = totalDays
+		}
+		if req.RequiredDays < 1 || req.RequiredDays > totalDays {
+			http.Error(w, "required_days must be between 1 and the length of the challenge", http.StatusBadRequest)
+			return
+		}
+
+		var templateExists bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM templates WHERE id = $1)`, req.TemplateID).Scan(&templateExists)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("CreateChallenge template check error:", err)
+			return
+		}
+		if !templateExists {
+			http.Error(w, "Template not found", http.StatusBadRequest)
+			return
+		}
+
+		var id int
+		err = db.QueryRow(`
+			INSERT INTO challenges (title, description, template_id, start_date, end_date, required_days)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`,
+			req.Title, req.Description, req.TemplateID, start, end, req.RequiredDays).Scan(&id)
+		if err != nil {
+			http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+			log.Println("CreateChallenge insert error:", err)
+			return
+		}
+
+		c, err := scanChallenge(db.QueryRow(challengeSelectSQL+` WHERE c.id = $2`, 0, id),
+			time.Now().UTC().Truncate(24*time.Hour))
+		if err != nil {
+			http.Error(w, "Failed to fetch challenge", http.StatusInternalServerError)
+			log.Println("CreateChallenge fetch error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// DeleteChallenge removes a challenge and its participants. Score bonuses
+// already awarded for it stay in the ledger.
+func DeleteChallenge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		challengeID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM challenges WHERE id = $1`, challengeID)
+		if err != nil {
+			http.Error(w, "Failed to delete challenge", http.StatusInternalServerError)
+			log.Println("DeleteChallenge error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Challenge not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Challenge deleted"})
+	}
+}
+
+// JoinChallenge signs the authenticated user up for a challenge that hasn't
+// ended. Entries they already wrote during it count, so joining can complete
+// it straight away.
+func JoinChallenge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		challengeID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+			return
+		}
+
+		today, err := userJournalToday(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to join challenge", http.StatusInternalServerError)
+			log.Println("JoinChallenge user error:", err)
+			return
+		}
+
+		var endDate time.Time
+		err = db.QueryRow(`SELECT end_date FROM challenges WHERE id = $1`, challengeID).Scan(&endDate)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Challenge not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to join challenge", http.StatusInternalServerError)
+			log.Println("JoinChallenge lookup error:", err)
+			return
+		}
+		if today.After(endDate.UTC()) {
+			http.Error(w, "This challenge has ended", http.StatusConflict)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`
+			INSERT INTO challenge_participants (challenge_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (challenge_id, user_id) DO NOTHING`,
+			challengeID, userID)
+		if err != nil {
+			http.Error(w, "Failed to join challenge", http.StatusInternalServerError)
+			log.Println("JoinChallenge insert error:", err)
+			return
+		}
+
+		if err := completeChallenges(tx, userID); err != nil {
+			http.Error(w, "Failed to join challenge", http.StatusInternalServerError)
+			log.Println("JoinChallenge completion error:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		c, err := scanChallenge(db.QueryRow(challengeSelectSQL+` WHERE c.id = $2`, userID, challengeID), today)
+		if err != nil {
+			http.Error(w, "Failed to fetch challenge", http.StatusInternalServerError)
+			log.Println("JoinChallenge fetch error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// LeaveChallenge takes the authenticated user out of a challenge they haven't
+// completed yet.
+func LeaveChallenge(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		challengeID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			DELETE FROM challenge_participants
+			WHERE challenge_id = $1 AND user_id = $2 AND completed_at IS NULL`,
+			challengeID, userID)
+		if err != nil {
+			http.Error(w, "Failed to leave challenge", http.StatusInternalServerError)
+			log.Println("LeaveChallenge error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			var completed bool
+			err = db.QueryRow(`
+				SELECT EXISTS(SELECT 1 FROM challenge_participants
+				              WHERE challenge_id = $1 AND user_id = $2)`,
+				challengeID, userID).Scan(&completed)
+			if err != nil {
+				http.Error(w, "Failed to leave challenge", http.StatusInternalServerError)
+				log.Println("LeaveChallenge lookup error:", err)
+				return
+			}
+			if completed {
+				http.Error(w, "Completed challenges can't be left", http.StatusConflict)
+				return
+			}
+			http.Error(w, "You haven't joined this challenge", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Left challenge"})
+	}
+}
+
+// GetChallengeProgress shows a participant's progress: which of the
+// challenge's days so far have an entry with its template, in the
+// participant's own journal days. Only those who can see the participant's
+// posts may see it.
+func GetChallengeProgress(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		vars := mux.Vars(r)
+		challengeID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+			return
+		}
+		userID, err := strconv.Atoi(vars["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		if userID != viewerID {
+			blocked, err := isBlockedEitherWay(db, viewerID, userID)
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				log.Println("GetChallengeProgress block check error:", err)
+				return
+			}
+			if blocked {
+				http.Error(w, "Participant not found", http.StatusNotFound)
+				return
+			}
+
+			visible, err := canViewPostsOf(db, viewerID, userID)
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				log.Println("GetChallengeProgress visibility error:", err)
+				return
+			}
+			if !visible {
+				http.Error(w, "You cannot view this user's progress", http.StatusForbidden)
+				return
+			}
+		}
+
+		today, err := userJournalToday(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Participant not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch progress", http.StatusInternalServerError)
+			log.Println("GetChallengeProgress user error:", err)
+			return
+		}
+
+		// Read from the participant's point of view, so joined and
+		// completed_at are theirs.
+		c, err := scanChallenge(db.QueryRow(challengeSelectSQL+` WHERE c.id = $2`, userID, challengeID), today)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Challenge not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch progress", http.StatusInternalServerError)
+			log.Println("GetChallengeProgress challenge error:", err)
+			return
+		}
+		if !c.Joined {
+			http.Error(w, "Participant not found", http.StatusNotFound)
+			return
+		}
+
+		days := []challengeDay{}
+		daysDone := 0
+		to := c.endDate
+		if today.Before(to) {
+			to = today
+		}
+		if !to.Before(c.startDate) {
+			rows, err := db.Query(`
+				SELECT to_char(d, 'YYYY-MM-DD'),
+				       EXISTS (SELECT 1 FROM posts
+				               WHERE user_id = $1 AND template_id = $2 AND journal_date = d::date)
+				FROM generate_series($3::date, $4::date, INTERVAL '1 day') AS d
+				ORDER BY d`,
+				userID, c.TemplateID, c.startDate, to)
+			if err != nil {
+				http.Error(w, "Failed to fetch progress", http.StatusInternalServerError)
+				log.Println("GetChallengeProgress days error:", err)
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var d challengeDay
+				if err := rows.Scan(&d.Date, &d.Done); err != nil {
+					http.Error(w, "Failed to fetch progress", http.StatusInternalServerError)
+					log.Println("GetChallengeProgress days scan error:", err)
+					return
+				}
+				if d.Done {
+					daysDone++
+				}
+				days = append(days, d)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"challenge_id":  c.ID,
+			"user_id":       userID,
+			"completed":     c.CompletedAt != nil,
+			"completed_at":  c.CompletedAt,
+			"days_done":     daysDone,
+			"required_days": c.RequiredDays,
+			"total_days":    c.TotalDays,
+			"days":          days,
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	circleFeedDefaultLimit = 30
+	circleFeedMaxLimit     = 100
+)
+
+type circleComment struct {
+	ID          int       `json:"id"`
+	CircleID    int       `json:"circle_id"`
+	PostID      int       `json:"post_id"`
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Text        string    `json:"text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ShareToCircles shares one of the authenticated user's posts to circles
+// they belong to. Sharing again to the same circle is a no-op.
+func ShareToCircles(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		postID, err := strconv.Atoi(mux.Vars(r)["postId"])
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			CircleIDs []int `json:"circle_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.CircleIDs) == 0 {
+			http.Error(w, "circle_ids is required", http.StatusBadRequest)
+			return
+		}
+
+		var ownerID int
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = $1`, postID).Scan(&ownerID)
+		if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("ShareToCircles post error:", err)
+			return
+		}
+
+		ids := make(pq.Int64Array, len(req.CircleIDs))
+		for i, id := range req.CircleIDs {
+			ids[i] = int64(id)
+		}
+
+		var memberOf int
+		err = db.QueryRow(`
+			SELECT COUNT(DISTINCT circle_id) FROM circle_members
+			WHERE user_id = $1 AND circle_id = ANY($2)`,
+			userID, ids).Scan(&memberOf)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("ShareToCircles membership error:", err)
+			return
+		}
+
+		var distinct int
+		seen := make(map[int]bool)
+		for _, id := range req.CircleIDs {
+			if !seen[id] {
+				seen[id] = true
+				distinct++
+			}
+		}
+		if memberOf != distinct {
+			http.Error(w, "You can only share to circles you belong to", http.StatusForbidden)
+			return
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO circle_posts (circle_id, post_id)
+			SELECT DISTINCT unnest($1::int[]), $2::int
+			ON CONFLICT (circle_id, post_id) DO NOTHING`,
+			ids, postID)
+		if err != nil {
+			http.Error(w, "Failed to share post", http.StatusInternalServerError)
+			log.Println("ShareToCircles insert error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"post_id":    postID,
+			"circle_ids": req.CircleIDs,
+		})
+	}
+}
+
+// UnshareFromCircle takes a post out of a circle, with its circle comments.
+// The author can always do so, the owner and admins for anyone's post.
+func UnshareFromCircle(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		postID, err := strconv.Atoi(mux.Vars(r)["postId"])
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			DELETE FROM circle_posts cp
+			USING posts p
+			WHERE cp.circle_id = $1 AND cp.post_id = $2 AND p.id = cp.post_id
+			  AND (p.user_id = $3 OR $4)`,
+			circleID, postID, userID, canManageCircle(role))
+		if err != nil {
+			http.Error(w, "Failed to remove post", http.StatusInternalServerError)
+			log.Println("UnshareFromCircle error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Post not found in this circle", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Post removed from circle",
+		})
+	}
+}
+
+// circleAuthorVisibleSQL is a condition that holds when the viewer bound to
+// param may see circle entries and comments by the user in column: never
+// across a block, and for private accounts only when canViewPostsOf would
+// allow it. NULL is_private counts as private.
+func circleAuthorVisibleSQL(column, param string) string {
+	return `(` + column + ` NOT IN ` + blockedUsersSQL(param) + `
+		AND (` + column + ` IN ` + visibleAuthorsSQL(param) + `
+		     OR NOT COALESCE((SELECT is_private FROM users WHERE id = ` + column + `), true)))`
+}
+
+// canViewCircleContentOf applies circleAuthorVisibleSQL to one author.
+func canViewCircleContentOf(db *sql.DB, viewerID, authorID int) (bool, error) {
+	var visible bool
+	err := db.QueryRow(`SELECT `+circleAuthorVisibleSQL("$2::int", "$1"), viewerID, authorID).Scan(&visible)
+	return visible, err
+}
+
+// GetCircleFeed returns the posts shared to a circle, most recently shared
+// first. Pass the last item's shared_at as ?before= for the next page. Posts
+// by anyone the viewer blocked, muted or was blocked by are left out, and so
+// are posts by private accounts the viewer doesn't share a follow with.
+func GetCircleFeed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, _, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+
+		limit := circleFeedDefaultLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > circleFeedMaxLimit {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+		}
+		before := time.Now().Add(time.Minute)
+		if s := r.URL.Query().Get("before"); s != "" {
+			var err error
+			before, err = time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				http.Error(w, "before must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+
+		rows, err := db.Query(`
+			SELECT
+				p.id,
+				p.user_id,
+				p.template_id,
+				p.text,
+				COALESCE(p.photo_path, '') AS photo_path,
+				p.created_at,
+				p.journal_date,
+				u.username,
+				u.display_name,
+				cp.shared_at,
+				(SELECT COUNT(*) FROM circle_comments cc
+				 WHERE cc.circle_id = cp.circle_id AND cc.post_id = p.id
+				   AND `+circleAuthorVisibleSQL("cc.user_id", "$2")+`) AS comment_count,
+				COALESCE((SELECT COUNT(*) FROM reactions WHERE post_id = p.id), 0) AS total_reactions,
+				(SELECT reaction_type FROM reactions WHERE post_id = p.id AND user_id = $2) AS user_reaction
+			FROM circle_posts cp
+			JOIN posts p ON p.id = cp.post_id
+			JOIN users u ON u.id = p.user_id
+			WHERE cp.circle_id = $1
+			  AND `+circleAuthorVisibleSQL("p.user_id", "$2")+`
+			  AND p.user_id NOT IN (SELECT muted_id FROM user_mutes WHERE muter_id = $2)
+			  AND cp.shared_at < $3
+			ORDER BY cp.shared_at DESC
+			LIMIT $4`,
+			circleID, userID, before, limit)
+		if err != nil {
+			http.Error(w, "Failed to fetch circle feed", http.StatusInternalServerError)
+			log.Println("GetCircleFeed query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		feed := []map[string]interface{}{}
+		for rows.Next() {
+			var (
+				id, authorID, templateID   int
+				text, photoPath            string
+				createdAt, journalDate     time.Time
+				username, displayName      string
+				sharedAt                   time.Time
+				commentCount, totalReacted int
+				userReaction               sql.NullString
+			)
+			if err := rows.Scan(&id, &authorID, &templateID, &text, &photoPath, &createdAt, &journalDate,
+				&username, &displayName, &sharedAt, &commentCount, &totalReacted, &userReaction); err != nil {
+				http.Error(w, "Error scanning circle feed", http.StatusInternalServerError)
+				log.Println("GetCircleFeed scan error:", err)
+				return
+			}
+
+			var reaction interface{}
+			if userReaction.Valid {
+				reaction = userReaction.String
+			}
+
+			feed = append(feed, map[string]interface{}{
+				"id":              id,
+				"user_id":         authorID,
+				"template_id":     templateID,
+				"text":            text,
+				"photo_path":      photoPath,
+				"created_at":      createdAt.Format(time.RFC3339),
+				"journal_date":    journalDate.Format("2006-01-02"),
+				"username":        username,
+				"display_name":    displayName,
+				"shared_at":       sharedAt.Format(time.RFC3339Nano),
+				"comment_count":   commentCount,
+				"total_reactions": totalReacted,
+				"user_reaction":   reaction,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(feed)
+	}
+}
+
+// circlePostAuthor returns the author of a post shared to the circle, or
+// sql.ErrNoRows if it isn't shared there.
+func circlePostAuthor(db *sql.DB, circleID, postID int) (int, error) {
+	var authorID int
+	err := db.QueryRow(`
+		SELECT p.user_id
+		FROM circle_posts cp
+		JOIN posts p ON p.id = cp.post_id
+		WHERE cp.circle_id = $1 AND cp.post_id = $2`,
+		circleID, postID).Scan(&authorID)
+	return authorID, err
+}
+
+// GetCircleComments lists the comments members left on a post within the
+// circle. They are separate from the post's public comments, and follow the
+// same visibility rules as the feed.
+func GetCircleComments(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, _, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		postID, err := strconv.Atoi(mux.Vars(r)["postId"])
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		authorID, err := circlePostAuthor(db, circleID, postID)
+		if err == nil {
+			var visible bool
+			if visible, err = canViewCircleContentOf(db, userID, authorID); err == nil && !visible {
+				err = sql.ErrNoRows
+			}
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found in this circle", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			log.Println("GetCircleComments post error:", err)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT c.id, c.circle_id, c.post_id, c.user_id, u.username, u.display_name, c.text, c.created_at
+			FROM circle_comments c
+			JOIN users u ON u.id = c.user_id
+			WHERE c.circle_id = $1 AND c.post_id = $2
+			  AND `+circleAuthorVisibleSQL("c.user_id", "$3")+`
+			ORDER BY c.created_at ASC`,
+			circleID, postID, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			log.Println("GetCircleComments query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		comments := []circleComment{}
+		for rows.Next() {
+			var c circleComment
+			if err := rows.Scan(&c.ID, &c.CircleID, &c.PostID, &c.UserID, &c.Username, &c.DisplayName, &c.Text, &c.CreatedAt); err != nil {
+				http.Error(w, "Error scanning comments", http.StatusInternalServerError)
+				log.Println("GetCircleComments scan error:", err)
+				return
+			}
+			comments = append(comments, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(comments)
+	}
+}
+
+func CreateCircleComment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, _, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		postID, err := strconv.Atoi(mux.Vars(r)["postId"])
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Text == "" {
+			http.Error(w, "Comment text is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Text) > 500 {
+			http.Error(w, "Comment must be at most 500 characters", http.StatusBadRequest)
+			return
+		}
+
+		authorID, err := circlePostAuthor(db, circleID, postID)
+		if err == nil {
+			var visible bool
+			if visible, err = canViewCircleContentOf(db, userID, authorID); err == nil && !visible {
+				err = sql.ErrNoRows
+			}
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found in this circle", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("CreateCircleComment post error:", err)
+			return
+		}
+
+		c := circleComment{CircleID: circleID, PostID: postID, UserID: userID, Text: req.Text}
+		err = db.QueryRow(`
+			INSERT INTO circle_comments (circle_id, post_id, user_id, text)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at`,
+			circleID, postID, userID, req.Text).Scan(&c.ID, &c.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+			log.Println("CreateCircleComment error:", err)
+			return
+		}
+		err = db.QueryRow(`SELECT username, display_name FROM users WHERE id = $1`, userID).
+			Scan(&c.Username, &c.DisplayName)
+		if err != nil {
+			log.Println("CreateCircleComment user error:", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// DeleteCircleComment removes a circle comment. Its author, the post's
+// author, the owner and admins may do so.
+func DeleteCircleComment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		commentID, err := strconv.Atoi(mux.Vars(r)["commentId"])
+		if err != nil {
+			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			DELETE FROM circle_comments c
+			USING posts p
+			WHERE c.id = $1 AND c.circle_id = $2 AND p.id = c.post_id
+			  AND (c.user_id = $3 OR p.user_id = $3 OR $4)`,
+			commentID, circleID, userID, canManageCircle(role))
+		if err != nil {
+			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+			log.Println("DeleteCircleComment error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Comment deleted",
+		})
+	}
+}
@@ -0,0 +1,667 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	circleRoleOwner  = "owner"
+	circleRoleAdmin  = "admin"
+	circleRoleMember = "member"
+)
+
+const (
+	// circleMaxMembers keeps circles small.
+	circleMaxMembers = 30
+	// circleMaxNameLength limits a circle's name, in characters.
+	circleMaxNameLength = 60
+
+	circleInviteDefaultTTL = 72 * time.Hour
+	circleInviteMaxTTL     = 30 * 24 * time.Hour
+)
+
+type Circle struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     int       `json:"owner_id"`
+	MemberCount int       `json:"member_count"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type circleMember struct {
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// circleRole returns the user's role in the circle, or "" if they aren't a
+// member.
+func circleRole(q queryer, circleID, userID int) (string, error) {
+	var role string
+	err := q.QueryRow(`SELECT role FROM circle_members WHERE circle_id = $1 AND user_id = $2`,
+		circleID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+func canManageCircle(role string) bool {
+	return role == circleRoleOwner || role == circleRoleAdmin
+}
+
+// circleRequest reads the authenticated user and the {id} circle from r and
+// checks the user is a member. It writes the error response itself and
+// returns ok false when the request can't go on.
+func circleRequest(db *sql.DB, w http.ResponseWriter, r *http.Request) (userID, circleID int, role string, ok bool) {
+	userID, err := authenticatedUserID(db, r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, "", false
+	}
+	circleID, err = strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid circle ID", http.StatusBadRequest)
+		return 0, 0, "", false
+	}
+
+	role, err = circleRole(db, circleID, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Println("circleRequest role error:", err)
+		return 0, 0, "", false
+	}
+	// Non-members can't tell a circle exists.
+	if role == "" {
+		http.Error(w, "Circle not found", http.StatusNotFound)
+		return 0, 0, "", false
+	}
+	return userID, circleID, role, true
+}
+
+func hashCircleInvite(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// removeCircleMember takes the user out of the circle along with the posts
+// they shared to it.
+func removeCircleMember(tx *sql.Tx, circleID, userID int) error {
+	_, err := tx.Exec(`
+		DELETE FROM circle_posts cp
+		USING posts p
+		WHERE cp.circle_id = $1 AND cp.post_id = p.id AND p.user_id = $2`,
+		circleID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM circle_members WHERE circle_id = $1 AND user_id = $2`, circleID, userID)
+	return err
+}
+
+func CreateCircle(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len([]rune(req.Name)) > circleMaxNameLength {
+			http.Error(w, "Name must be between 1 and 60 characters", http.StatusBadRequest)
+			return
+		}
+		if len(req.Description) > 500 {
+			http.Error(w, "Description must be at most 500 characters", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		c := Circle{Name: req.Name, Description: req.Description, OwnerID: userID, MemberCount: 1, Role: circleRoleOwner}
+		err = tx.QueryRow(`
+			INSERT INTO circles (name, description, owner_id)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at`,
+			req.Name, req.Description, userID).Scan(&c.ID, &c.CreatedAt)
+		if err == nil {
+			_, err = tx.Exec(`
+				INSERT INTO circle_members (circle_id, user_id, role)
+				VALUES ($1, $2, $3)`,
+				c.ID, userID, circleRoleOwner)
+		}
+		if err != nil {
+			http.Error(w, "Failed to create circle", http.StatusInternalServerError)
+			log.Println("CreateCircle error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	}
+}
+
+// GetCircles lists the circles the authenticated user belongs to.
+func GetCircles(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT c.id, c.name, c.description, c.owner_id, m.role, c.created_at,
+			       (SELECT COUNT(*) FROM circle_members WHERE circle_id = c.id)
+			FROM circles c
+			JOIN circle_members m ON m.circle_id = c.id AND m.user_id = $1
+			ORDER BY c.name`,
+			userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch circles", http.StatusInternalServerError)
+			log.Println("GetCircles query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		circles := []Circle{}
+		for rows.Next() {
+			var c Circle
+			if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.OwnerID, &c.Role, &c.CreatedAt, &c.MemberCount); err != nil {
+				http.Error(w, "Failed to fetch circles", http.StatusInternalServerError)
+				log.Println("GetCircles scan error:", err)
+				return
+			}
+			circles = append(circles, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(circles)
+	}
+}
+
+// GetCircle returns a circle and its members, leaving out anyone with a
+// block either way with the viewer.
+func GetCircle(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+
+		c := Circle{ID: circleID, Role: role}
+		err := db.QueryRow(`
+			SELECT name, description, owner_id, created_at,
+			       (SELECT COUNT(*) FROM circle_members WHERE circle_id = $1)
+			FROM circles WHERE id = $1`,
+			circleID).Scan(&c.Name, &c.Description, &c.OwnerID, &c.CreatedAt, &c.MemberCount)
+		if err != nil {
+			http.Error(w, "Failed to fetch circle", http.StatusInternalServerError)
+			log.Println("GetCircle error:", err)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT u.id, u.username, u.display_name, m.role, m.joined_at
+			FROM circle_members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.circle_id = $1
+			  AND u.id NOT IN `+blockedUsersSQL("$2")+`
+			ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, m.joined_at`,
+			circleID, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch circle", http.StatusInternalServerError)
+			log.Println("GetCircle members error:", err)
+			return
+		}
+		defer rows.Close()
+
+		members := []circleMember{}
+		for rows.Next() {
+			var m circleMember
+			if err := rows.Scan(&m.UserID, &m.Username, &m.DisplayName, &m.Role, &m.JoinedAt); err != nil {
+				http.Error(w, "Failed to fetch circle", http.StatusInternalServerError)
+				log.Println("GetCircle members scan error:", err)
+				return
+			}
+			members = append(members, m)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"circle":  c,
+			"members": members,
+		})
+	}
+}
+
+// DeleteCircle removes a circle and everything shared in it. Owner only.
+func DeleteCircle(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		if role != circleRoleOwner {
+			http.Error(w, "Only the owner can delete a circle", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.Exec(`DELETE FROM circles WHERE id = $1`, circleID); err != nil {
+			http.Error(w, "Failed to delete circle", http.StatusInternalServerError)
+			log.Println("DeleteCircle error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Circle deleted",
+		})
+	}
+}
+
+// UpdateCircleMemberRole changes a member's role. Only the owner can do it;
+// making someone else owner hands the circle over and makes the previous
+// owner an admin.
+func UpdateCircleMemberRole(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		if role != circleRoleOwner {
+			http.Error(w, "Only the owner can change roles", http.StatusForbidden)
+			return
+		}
+
+		memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if memberID == userID {
+			http.Error(w, "Hand the circle to another member instead", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		switch req.Role {
+		case circleRoleOwner, circleRoleAdmin, circleRoleMember:
+		default:
+			http.Error(w, "role must be owner, admin or member", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`
+			UPDATE circle_members SET role = $3
+			WHERE circle_id = $1 AND user_id = $2`,
+			circleID, memberID, req.Role)
+		if err != nil {
+			http.Error(w, "Failed to update role", http.StatusInternalServerError)
+			log.Println("UpdateCircleMemberRole error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+
+		if req.Role == circleRoleOwner {
+			_, err = tx.Exec(`
+				UPDATE circle_members SET role = $3
+				WHERE circle_id = $1 AND user_id = $2`,
+				circleID, userID, circleRoleAdmin)
+			if err == nil {
+				_, err = tx.Exec(`UPDATE circles SET owner_id = $2 WHERE id = $1`, circleID, memberID)
+			}
+			if err != nil {
+				http.Error(w, "Failed to update role", http.StatusInternalServerError)
+				log.Println("UpdateCircleMemberRole transfer error:", err)
+				return
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id": memberID,
+			"role":    req.Role,
+		})
+	}
+}
+
+// RemoveCircleMember handles both leaving (removing yourself) and removing
+// someone else. Admins can remove members; the owner can remove anyone but
+// has to hand the circle over before leaving. The removed user's shares go
+// with them.
+func RemoveCircleMember(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		memberRole, err := circleRole(tx, circleID, memberID)
+		if err != nil {
+			http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+			log.Println("RemoveCircleMember role error:", err)
+			return
+		}
+		if memberRole == "" {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case memberRole == circleRoleOwner:
+			http.Error(w, "The owner must hand the circle to another member before leaving", http.StatusConflict)
+			return
+		case memberID == userID:
+		case role == circleRoleOwner:
+		case role == circleRoleAdmin && memberRole == circleRoleMember:
+		default:
+			http.Error(w, "You cannot remove this member", http.StatusForbidden)
+			return
+		}
+
+		if err := removeCircleMember(tx, circleID, memberID); err != nil {
+			http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+			log.Println("RemoveCircleMember error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		message := "Member removed"
+		if memberID == userID {
+			message = "You left the circle"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": message,
+		})
+	}
+}
+
+// CreateCircleInvite makes an invite link token for the circle. It expires
+// after expires_in_hours (72 by default, 720 at most) and, with max_uses,
+// after that many joins. The token is only ever shown here.
+func CreateCircleInvite(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		if !canManageCircle(role) {
+			http.Error(w, "Only the owner and admins can invite", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			ExpiresInHours int  `json:"expires_in_hours"`
+			MaxUses        *int `json:"max_uses"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ttl := circleInviteDefaultTTL
+		if req.ExpiresInHours != 0 {
+			ttl = time.Duration(req.ExpiresInHours) * time.Hour
+			if ttl <= 0 || ttl > circleInviteMaxTTL {
+				http.Error(w, "expires_in_hours must be between 1 and 720", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.MaxUses != nil && (*req.MaxUses < 1 || *req.MaxUses > circleMaxMembers) {
+			http.Error(w, "max_uses must be between 1 and 30", http.StatusBadRequest)
+			return
+		}
+
+		token := generateSecureToken()
+		expiresAt := time.Now().Add(ttl)
+
+		var inviteID int
+		err := db.QueryRow(`
+			INSERT INTO circle_invites (circle_id, token_hash, created_by, expires_at, max_uses)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			circleID, hashCircleInvite(token), userID, expiresAt, req.MaxUses).Scan(&inviteID)
+		if err != nil {
+			http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+			log.Println("CreateCircleInvite error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         inviteID,
+			"token":      token,
+			"expires_at": expiresAt,
+			"max_uses":   req.MaxUses,
+		})
+	}
+}
+
+func RevokeCircleInvite(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, circleID, role, ok := circleRequest(db, w, r)
+		if !ok {
+			return
+		}
+		if !canManageCircle(role) {
+			http.Error(w, "Only the owner and admins can revoke invites", http.StatusForbidden)
+			return
+		}
+		inviteID, err := strconv.Atoi(mux.Vars(r)["inviteId"])
+		if err != nil {
+			http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE circle_invites SET revoked_at = NOW()
+			WHERE id = $1 AND circle_id = $2 AND revoked_at IS NULL`,
+			inviteID, circleID)
+		if err != nil {
+			http.Error(w, "Failed to revoke invite", http.StatusInternalServerError)
+			log.Println("RevokeCircleInvite error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Invite not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Invite revoked",
+		})
+	}
+}
+
+// JoinCircle adds the authenticated user to the circle an invite token is
+// for. Users with a block either way with the owner can't join.
+func JoinCircle(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var inviteID, circleID int
+		err = tx.QueryRow(`
+			SELECT i.id, i.circle_id
+			FROM circle_invites i
+			WHERE i.token_hash = $1
+			  AND i.revoked_at IS NULL
+			  AND i.expires_at > NOW()
+			  AND (i.max_uses IS NULL OR i.uses < i.max_uses)
+			FOR UPDATE OF i`,
+			hashCircleInvite(req.Token)).Scan(&inviteID, &circleID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invite is invalid or has expired", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to join circle", http.StatusInternalServerError)
+			log.Println("JoinCircle invite error:", err)
+			return
+		}
+
+		if role, err := circleRole(tx, circleID, userID); err != nil || role != "" {
+			if err != nil {
+				http.Error(w, "Failed to join circle", http.StatusInternalServerError)
+				log.Println("JoinCircle role error:", err)
+				return
+			}
+			http.Error(w, "You are already in this circle", http.StatusConflict)
+			return
+		}
+
+		// Nobody joins a circle where they have a block either way with a member.
+		var blocked bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM circle_members
+				WHERE circle_id = $1 AND user_id IN `+blockedUsersSQL("$2")+`
+			)`,
+			circleID, userID).Scan(&blocked)
+		if err != nil {
+			http.Error(w, "Failed to join circle", http.StatusInternalServerError)
+			log.Println("JoinCircle block check error:", err)
+			return
+		}
+		if blocked {
+			http.Error(w, "Invite is invalid or has expired", http.StatusNotFound)
+			return
+		}
+
+		// Lock the circle so concurrent joins can't overshoot the limit.
+		var members int
+		err = tx.QueryRow(`
+			SELECT (SELECT COUNT(*) FROM circle_members WHERE circle_id = c.id)
+			FROM circles c WHERE c.id = $1
+			FOR UPDATE`,
+			circleID).Scan(&members)
+		if err != nil {
+			http.Error(w, "Failed to join circle", http.StatusInternalServerError)
+			log.Println("JoinCircle count error:", err)
+			return
+		}
+		if members >= circleMaxMembers {
+			http.Error(w, "This circle is full", http.StatusConflict)
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO circle_members (circle_id, user_id, role)
+			VALUES ($1, $2, $3)`,
+			circleID, userID, circleRoleMember)
+		if err == nil {
+			_, err = tx.Exec(`UPDATE circle_invites SET uses = uses + 1 WHERE id = $1`, inviteID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to join circle", http.StatusInternalServerError)
+			log.Println("JoinCircle insert error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Joined circle",
+			"circle_id": circleID,
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// cleanupQueries delete rows nothing reads anymore: expired tokens, and
+// finished work old enough that it no longer helps with debugging.
+var cleanupQueries = []struct {
+	name  string
+	query string
+}{
+	{"refresh tokens", `DELETE FROM refresh_tokens WHERE expires_at < NOW() - INTERVAL '1 day'`},
+	{"password resets", `DELETE FROM password_resets WHERE expires_at < NOW() - INTERVAL '1 day'`},
+	{"email verifications", `DELETE FROM email_verifications WHERE expires_at < NOW() - INTERVAL '1 day'`},
+	{"outbox events", `DELETE FROM outbox_events WHERE status = 'done' AND processed_at < NOW() - INTERVAL '7 days'`},
+	{"notification receipts", `DELETE FROM notification_receipts WHERE created_at < NOW() - INTERVAL '30 days'`},
+	{"sent mail", `DELETE FROM mail_queue WHERE status = 'sent' AND sent_at < NOW() - INTERVAL '30 days'`},
+	{"job runs", `DELETE FROM job_runs WHERE started_at < NOW() - INTERVAL '90 days'`},
+}
+
+// CleanupExpiredRecords prunes the tables in cleanupQueries. It keeps going
+// past a failing table and reports the first failure at the end, but stops
+// once ctx is done.
+func CleanupExpiredRecords(ctx context.Context, db *sql.DB) error {
+	var firstErr error
+	for _, c := range cleanupQueries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := db.ExecContext(ctx, c.query)
+		if err != nil {
+			log.Printf("[Cleanup] Failed to prune %s: %v", c.name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to prune %s: %w", c.name, err)
+			}
+			continue
+		}
+		n, _ := result.RowsAffected()
+		log.Printf("[Cleanup] Pruned %d %s", n, c.name)
+	}
+	return firstErr
+}
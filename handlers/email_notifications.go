@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// emailTypes are the notification types important enough to offer email for.
+// Email is off for them until the user opts in.
+var emailTypes = map[string]bool{
+	"follow_request": true,
+	"post_comment":   true,
+}
+
+// emailTypeLabels name each emailed type on the unsubscribe page.
+var emailTypeLabels = map[string]string{
+	"follow_request": "follow requests",
+	"post_comment":   "comments on your entries",
+	digestType:       "the weekly digest",
+}
+
+type emailEvent struct {
+	UserID int    `json:"user_id"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+// enqueueNotificationEmail queues n to be emailed to its recipient. Email goes
+// through the outbox rather than being sent inline so a slow or failing SMTP
+// server is retried on its own, without redelivering the push.
+func enqueueNotificationEmail(q queryer, n notification, title string) error {
+	key := n.DedupeKey
+	if key == "" {
+		key = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	return enqueueEvent(q, eventNotifyEmail, fmt.Sprintf("%s:%d", key, n.UserID), emailEvent{
+		UserID: n.UserID,
+		Type:   n.Type,
+		Title:  title,
+		Body:   n.Body,
+	})
+}
+
+// sendNotificationEmail queues the email for e. key is the outbox event's
+// idempotency key, so a redelivered event doesn't queue the email twice.
+func sendNotificationEmail(db *sql.DB, mailSvc *services.MailService, key string, e emailEvent) error {
+	if mailSvc == nil {
+		return errors.New("mail service is not configured")
+	}
+
+	var email, locale string
+	var verified bool
+	err := db.QueryRow(`SELECT email, email_verified, locale FROM users WHERE id = $1`, e.UserID).
+		Scan(&email, &verified, &locale)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !verified {
+		log.Printf("[Email] User %d has no verified email, skipping %s", e.UserID, e.Type)
+		return nil
+	}
+
+	// The user may have unsubscribed while this was queued.
+	pref, err := loadChannelPreference(db, e.UserID, e.Type)
+	if err != nil {
+		return err
+	}
+	if !pref.Email {
+		return nil
+	}
+
+	unsubscribe := unsubscribeURL(e.UserID, e.Type)
+	return queueMail(db, mailSvc, key, services.TemplatedMail{
+		To:       email,
+		Locale:   locale,
+		Template: "notification-email",
+		Data: map[string]string{
+			"Title":          e.Title,
+			"Body":           e.Body,
+			"Type":           e.Type,
+			"UnsubscribeURL": unsubscribe,
+		},
+		UnsubscribeURL: unsubscribe,
+	})
+}
+
+func unsubscribeSecret() []byte {
+	if secret := os.Getenv("UNSUBSCRIBE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return accessSecretKey
+}
+
+// apiBaseURL is where links that must reach this server, rather than the web
+// app, point to.
+func apiBaseURL() string {
+	if base := os.Getenv("API_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return "http://localhost:8200"
+}
+
+// unsubscribeToken signs userID and scope so the link works without the user
+// logging in. Tokens don't expire; unsubscribe links in old emails must keep
+// working.
+func unsubscribeToken(userID int, scope string) string {
+	payload := strconv.Itoa(userID) + ":" + scope
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func parseUnsubscribeToken(token string) (int, string, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errors.New("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", errors.New("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return 0, "", errors.New("malformed token")
+	}
+
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return 0, "", errors.New("invalid signature")
+	}
+
+	rawUserID, scope, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return 0, "", errors.New("malformed token")
+	}
+	userID, err := strconv.Atoi(rawUserID)
+	if err != nil {
+		return 0, "", errors.New("malformed token")
+	}
+
+	return userID, scope, nil
+}
+
+func unsubscribeURL(userID int, scope string) string {
+	return apiBaseURL() + "/email/unsubscribe?token=" + url.QueryEscape(unsubscribeToken(userID, scope))
+}
+
+// UnsubscribeEmail turns off the email channel for the scope in the signed
+// token. It answers GET, for people clicking the link, and POST, for mail
+// clients doing a List-Unsubscribe one-click unsubscribe.
+func UnsubscribeEmail(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, scope, err := parseUnsubscribeToken(r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+			return
+		}
+
+		label, ok := emailTypeLabels[scope]
+		if !ok {
+			http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+			return
+		}
+
+		def := defaultPreferenceFor(scope)
+		_, err = db.Exec(`
+			INSERT INTO notification_preferences (user_id, type, push, email, in_app)
+			VALUES ($1, $2, $3, FALSE, $4)
+			ON CONFLICT (user_id, type) DO UPDATE SET
+				email = FALSE,
+				updated_at = NOW()`,
+			userID, scope, def.Push, def.InApp)
+		if err != nil {
+			http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+			log.Println("UnsubscribeEmail error:", err)
+			return
+		}
+
+		log.Printf("[Email] User %d unsubscribed from %s", userID, scope)
+
+		if r.Method == http.MethodPost {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Unsubscribed successfully",
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!doctype html><html><head><meta charset="UTF-8"><title>Unsubscribed — Reflecto</title></head>`+
+			`<body style="font-family: Arial, sans-serif; text-align: center; padding: 64px 16px; color: #0d0f14">`+
+			`<h1 style="font-family: Georgia, serif; font-style: italic">You're unsubscribed</h1>`+
+			`<p>You won't get emails for %s anymore. You can turn them back on in the app's notification settings.</p>`+
+			`</body></html>`, label)
+	}
+}
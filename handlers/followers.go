@@ -48,6 +48,17 @@ func FollowUser(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		blocked, err := isBlockedEitherWay(db, followerID, req.FollowingID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("Error checking blocks: %v", err)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot follow this user", http.StatusForbidden)
+			return
+		}
+
 		log.Printf("Following user %d (private: %v)", req.FollowingID, isPrivate)
 
 		var followerFollowingCount, targetFollowersCount int
@@ -115,10 +126,19 @@ func FollowUser(db *sql.DB) http.HandlerFunc {
 
 		log.Printf("Creating follow with status: %s", status)
 
-		_, err = db.Exec(`
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var followID int
+		err = tx.QueryRow(`
 			INSERT INTO followers (follower_id, following_id, status, created_at, updated_at)
-			VALUES ($1, $2, $3, NOW(), NOW())`,
-			followerID, req.FollowingID, status)
+			VALUES ($1, $2, $3, NOW(), NOW())
+			RETURNING id`,
+			followerID, req.FollowingID, status).Scan(&followID)
 
 		if err != nil {
 			http.Error(w, "Failed to follow user", http.StatusInternalServerError)
@@ -126,10 +146,22 @@ func FollowUser(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if status == "accepted" {
-			go notifyNewFollower(db, followerID, req.FollowingID)
-		} else {
-			go notifyFollowRequest(db, followerID, req.FollowingID)
+		eventType := eventNotifyNewFollower
+		if status == "pending" {
+			eventType = eventNotifyFollowRequest
+		}
+		err = enqueueEvent(tx, eventType, "follow:"+strconv.Itoa(followID), followEvent{
+			FollowerID: followerID, FollowingID: req.FollowingID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to follow user", http.StatusInternalServerError)
+			log.Println("FollowUser outbox error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
@@ -146,24 +178,44 @@ func AcceptFollowRequest(db *sql.DB) http.HandlerFunc {
 		userID, _ := strconv.Atoi(vars["user_id"])
 		followerID, _ := strconv.Atoi(vars["follower_id"])
 
-		result, err := db.Exec(`
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var followID int
+		err = tx.QueryRow(`
 			UPDATE followers 
 			SET status = 'accepted', updated_at = NOW()
-			WHERE follower_id = $1 AND following_id = $2 AND status = 'pending'`,
-			followerID, userID)
+			WHERE follower_id = $1 AND following_id = $2 AND status = 'pending'
+			RETURNING id`,
+			followerID, userID).Scan(&followID)
 
+		if err == sql.ErrNoRows {
+			http.Error(w, "Follow request not found or already processed", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to accept follow request", http.StatusInternalServerError)
 			log.Println("AcceptFollowRequest error:", err)
 			return
 		}
 
-		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-			http.Error(w, "Follow request not found or already processed", http.StatusNotFound)
+		err = enqueueEvent(tx, eventNotifyFollowAccepted, "follow:"+strconv.Itoa(followID), followEvent{
+			FollowerID: followerID, FollowingID: userID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to accept follow request", http.StatusInternalServerError)
+			log.Println("AcceptFollowRequest outbox error:", err)
 			return
 		}
 
-		go notifyFollowAccepted(db, userID, followerID)
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -553,113 +605,71 @@ func CheckFollowStatus(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func notifyNewFollower(db *sql.DB, followerID, followingID int) {
-	var followerName string
-	err := db.QueryRow("SELECT display_name FROM users WHERE id = $1", followerID).Scan(&followerName)
-	if err != nil {
-		log.Printf("Error getting follower name: %v", err)
-		followerName = "Someone"
-	}
-
-	rows, err := db.Query(`
-		SELECT token FROM fcm_tokens 
-		WHERE user_id = $1 AND token IS NOT NULL AND token != ''`,
-		followingID)
-	if err != nil {
-		log.Printf("Error fetching FCM tokens: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	var tokens []string
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			continue
-		}
-		tokens = append(tokens, token)
+func notifyNewFollower(db *sql.DB, push services.PushSender, eventKey string, followerID, followingID int) error {
+	if blocked, err := isBlockedEitherWay(db, followerID, followingID); err != nil || blocked {
+		return err
 	}
 
-	if len(tokens) > 0 {
-		data := map[string]string{
+	followerName := fetchDisplayName(db, followerID, "Someone")
+
+	return deliverNotification(db, push, notification{
+		UserID:     followingID,
+		ActorID:    followerID,
+		Type:       "new_follower",
+		TargetType: "user",
+		TargetID:   followerID,
+		Title:      "New Follower",
+		Body:       followerName + " started following you!",
+		Data: map[string]string{
 			"type":        "new_follower",
 			"follower_id": strconv.Itoa(followerID),
-		}
-		services.SendMultipleNotifications(db, tokens, "New Follower",
-			followerName+" started following you!", data)
-	}
+		},
+		DedupeKey: eventKey,
+	})
 }
 
-func notifyFollowRequest(db *sql.DB, followerID, followingID int) {
-	var followerName string
-	err := db.QueryRow("SELECT display_name FROM users WHERE id = $1", followerID).Scan(&followerName)
-	if err != nil {
-		log.Printf("Error getting follower name: %v", err)
-		followerName = "Someone"
-	}
-
-	rows, err := db.Query(`
-		SELECT token FROM fcm_tokens 
-		WHERE user_id = $1 AND token IS NOT NULL AND token != ''`,
-		followingID)
-	if err != nil {
-		log.Printf("Error fetching FCM tokens: %v", err)
-		return
+func notifyFollowRequest(db *sql.DB, push services.PushSender, eventKey string, followerID, followingID int) error {
+	if blocked, err := isBlockedEitherWay(db, followerID, followingID); err != nil || blocked {
+		return err
 	}
-	defer rows.Close()
 
-	var tokens []string
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			continue
-		}
-		tokens = append(tokens, token)
-	}
-
-	if len(tokens) > 0 {
-		data := map[string]string{
+	followerName := fetchDisplayName(db, followerID, "Someone")
+
+	return deliverNotification(db, push, notification{
+		UserID:     followingID,
+		ActorID:    followerID,
+		Type:       "follow_request",
+		TargetType: "user",
+		TargetID:   followerID,
+		Title:      "Follow Request",
+		Body:       followerName + " wants to follow you",
+		Data: map[string]string{
 			"type":        "follow_request",
 			"follower_id": strconv.Itoa(followerID),
-		}
-		services.SendMultipleNotifications(db, tokens, "Follow Request",
-			followerName+" wants to follow you", data)
-	}
+		},
+		DedupeKey: eventKey,
+	})
 }
 
-func notifyFollowAccepted(db *sql.DB, accepterID, followerID int) {
-	var accepterName string
-	err := db.QueryRow("SELECT display_name FROM users WHERE id = $1", accepterID).Scan(&accepterName)
-	if err != nil {
-		log.Printf("Error getting accepter name: %v", err)
-		accepterName = "Someone"
-	}
-
-	rows, err := db.Query(`
-		SELECT token FROM fcm_tokens 
-		WHERE user_id = $1 AND token IS NOT NULL AND token != ''`,
-		followerID)
-	if err != nil {
-		log.Printf("Error fetching FCM tokens: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	var tokens []string
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			continue
-		}
-		tokens = append(tokens, token)
+func notifyFollowAccepted(db *sql.DB, push services.PushSender, eventKey string, accepterID, followerID int) error {
+	if blocked, err := isBlockedEitherWay(db, accepterID, followerID); err != nil || blocked {
+		return err
 	}
 
-	if len(tokens) > 0 {
-		data := map[string]string{
+	accepterName := fetchDisplayName(db, accepterID, "Someone")
+
+	return deliverNotification(db, push, notification{
+		UserID:     followerID,
+		ActorID:    accepterID,
+		Type:       "follow_accepted",
+		TargetType: "user",
+		TargetID:   accepterID,
+		Title:      "Follow Request Accepted",
+		Body:       accepterName + " accepted your follow request!",
+		Data: map[string]string{
 			"type":    "follow_accepted",
 			"user_id": strconv.Itoa(accepterID),
-		}
-		services.SendMultipleNotifications(db, tokens, "Follow Request Accepted",
-			accepterName+" accepted your follow request!", data)
-	}
+		},
+		DedupeKey: eventKey,
+	})
 }
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"masterboxer.com/project-micro-journal/models"
+)
+
+// notificationCursor marks the last notification of an inbox page. The inbox
+// is ordered by updated_at so that a group which just absorbed a new event
+// moves back to the top.
+type notificationCursor struct {
+	UpdatedAt time.Time
+	ID        int64
+}
+
+func (c notificationCursor) encode() string {
+	raw := c.UpdatedAt.UTC().Format(time.RFC3339Nano) + "_" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeNotificationCursor(s string) (*notificationCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	timePart, idPart, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &notificationCursor{UpdatedAt: updatedAt, ID: id}, nil
+}
+
+func GetNotifications(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := 20
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 100 {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+		}
+
+		cursor, err := decodeNotificationCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+
+		var cursorTime *time.Time
+		var cursorID *int64
+		if cursor != nil {
+			cursorTime = &cursor.UpdatedAt
+			cursorID = &cursor.ID
+		}
+
+		unreadOnly := r.URL.Query().Get("unread_only") == "true"
+
+		rows, err := db.Query(`
+			SELECT id, user_id, actor_id, actor_ids, actor_count, type, target_type, target_id,
+			       title, body, payload, read_at, created_at, updated_at
+			FROM notifications
+			WHERE user_id = $1
+			  AND ($2::timestamptz IS NULL OR (updated_at, id) < ($2::timestamptz, $3::bigint))
+			  AND (NOT $4 OR read_at IS NULL)
+			ORDER BY updated_at DESC, id DESC
+			LIMIT $5`,
+			userID, cursorTime, cursorID, unreadOnly, limit+1)
+		if err != nil {
+			http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+			log.Println("GetNotifications query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		notifications := []models.Notification{}
+		hasMore := false
+		for rows.Next() {
+			if len(notifications) == limit {
+				hasMore = true
+				break
+			}
+
+			var n models.Notification
+			var payload []byte
+			var actorIDs pq.Int64Array
+			if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &actorIDs, &n.ActorCount, &n.Type,
+				&n.TargetType, &n.TargetID, &n.Title, &n.Body, &payload, &n.ReadAt,
+				&n.CreatedAt, &n.UpdatedAt); err != nil {
+				http.Error(w, "Error scanning notifications", http.StatusInternalServerError)
+				log.Println("GetNotifications scan error:", err)
+				return
+			}
+			n.Payload = payload
+			n.ActorIDs = actorIDs
+			notifications = append(notifications, n)
+		}
+
+		var unreadCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM notifications
+			WHERE user_id = $1 AND read_at IS NULL`,
+			userID).Scan(&unreadCount)
+		if err != nil {
+			log.Println("GetNotifications unread count error:", err)
+		}
+
+		var nextCursor string
+		if hasMore {
+			last := notifications[len(notifications)-1]
+			nextCursor = notificationCursor{UpdatedAt: last.UpdatedAt, ID: last.ID}.encode()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"notifications": notifications,
+			"unread_count":  unreadCount,
+			"next_cursor":   nextCursor,
+		})
+	}
+}
+
+func GetUnreadNotificationCount(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var unreadCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM notifications
+			WHERE user_id = $1 AND read_at IS NULL`,
+			userID).Scan(&unreadCount)
+		if err != nil {
+			http.Error(w, "Failed to count notifications", http.StatusInternalServerError)
+			log.Println("GetUnreadNotificationCount error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{
+			"unread_count": unreadCount,
+		})
+	}
+}
+
+func MarkNotificationRead(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		vars := mux.Vars(r)
+		notificationID, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE notifications
+			SET read_at = COALESCE(read_at, NOW())
+			WHERE id = $1 AND user_id = $2`,
+			notificationID, userID)
+		if err != nil {
+			http.Error(w, "Failed to mark notification as read", http.StatusInternalServerError)
+			log.Println("MarkNotificationRead error:", err)
+			return
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Notification marked as read",
+		})
+	}
+}
+
+func MarkAllNotificationsRead(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE notifications
+			SET read_at = NOW()
+			WHERE user_id = $1 AND read_at IS NULL`,
+			userID)
+		if err != nil {
+			http.Error(w, "Failed to mark notifications as read", http.StatusInternalServerError)
+			log.Println("MarkAllNotificationsRead error:", err)
+			return
+		}
+
+		marked, _ := result.RowsAffected()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "All notifications marked as read",
+			"marked":  marked,
+		})
+	}
+}
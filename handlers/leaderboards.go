@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	leaderboardDefaultLimit = 50
+	leaderboardMaxLimit     = 100
+)
+
+// leaderboardPeriods are the windows a leaderboard can cover, rolling back
+// from now. "all" has no window.
+var leaderboardPeriods = map[string]time.Duration{
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+// leaderboardDefaultPeriod is the period each metric uses when none is asked
+// for. Streaks are always current, so they take no period.
+var leaderboardDefaultPeriod = map[string]string{
+	"score":  "all",
+	"streak": "",
+	"posts":  "week",
+}
+
+type leaderboardEntry struct {
+	Rank        int    `json:"rank"`
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Value       int    `json:"value"`
+	IsViewer    bool   `json:"is_viewer"`
+}
+
+// leaderboardMembersSQL lists who may appear on the viewer's leaderboard:
+// the viewer and the people they share an accepted follow with, minus blocks
+// and anyone who opted out. Private accounts only show to their accepted
+// followers.
+func leaderboardMembersSQL(param string) string {
+	return `(
+		SELECT u.id FROM users u
+		WHERE u.id IN ` + visibleAuthorsSQL(param) + `
+		  AND u.id NOT IN ` + blockedUsersSQL(param) + `
+		  AND (u.id = ` + param + ` OR (
+		        NOT u.leaderboard_opt_out
+		        AND (NOT COALESCE(u.is_private, false) OR EXISTS (
+		            SELECT 1 FROM followers f
+		            WHERE f.follower_id = ` + param + ` AND f.following_id = u.id
+		              AND f.status = 'accepted'))))
+	)`
+}
+
+// GetLeaderboard ranks the viewer among the people they follow or are
+// followed by. ?metric= is score (points earned in the period, from the
+// ledger), streak (current streak) or posts (entries written in the period);
+// ?period= is week, month or all.
+func GetLeaderboard(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			metric = "score"
+		}
+		period, ok := leaderboardDefaultPeriod[metric]
+		if !ok {
+			http.Error(w, "metric must be score, streak or posts", http.StatusBadRequest)
+			return
+		}
+		if p := r.URL.Query().Get("period"); p != "" && metric != "streak" {
+			if _, ok := leaderboardPeriods[p]; !ok {
+				http.Error(w, "period must be week, month or all", http.StatusBadRequest)
+				return
+			}
+			period = p
+		}
+
+		limit := leaderboardDefaultLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > leaderboardMaxLimit {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var since time.Time
+		if window := leaderboardPeriods[period]; window > 0 {
+			since = time.Now().Add(-window)
+		}
+
+		var entries []leaderboardEntry
+		if metric == "streak" {
+			entries, err = streakLeaderboard(db, viewerID)
+		} else {
+			entries, err = countLeaderboard(db, viewerID, metric, since)
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+			log.Println("GetLeaderboard error:", err)
+			return
+		}
+
+		rankLeaderboard(entries)
+
+		var viewer *leaderboardEntry
+		for i := range entries {
+			if entries[i].UserID == viewerID {
+				entries[i].IsViewer = true
+				v := entries[i]
+				viewer = &v
+			}
+		}
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metric":  metric,
+			"period":  period,
+			"entries": entries,
+			"viewer":  viewer,
+		})
+	}
+}
+
+// countLeaderboard scores members by points earned or posts written since
+// since, or ever when since is zero. Points earned over a window leave out
+// opening balances, which carry each user's whole pre-ledger score, and
+// decay, which is lost to inactivity rather than earned; reversals such as
+// an unlike still count against the points they undo. The all-time board is
+// the score itself, decay included.
+func countLeaderboard(db *sql.DB, viewerID int, metric string, since time.Time) ([]leaderboardEntry, error) {
+	var value string
+	switch {
+	case metric == "score" && since.IsZero():
+		value = `COALESCE((SELECT s.score FROM reflecto_scores s WHERE s.user_id = u.id), 0)`
+	case metric == "score":
+		value = `(SELECT COALESCE(SUM(l.points), 0) FROM score_ledger l
+		          WHERE l.user_id = u.id AND l.created_at >= $2
+		            AND l.action NOT IN ('opening_balance', 'decay'))`
+	case since.IsZero():
+		value = `(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id)`
+	default:
+		value = `(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.created_at >= $2)`
+	}
+
+	args := []interface{}{viewerID}
+	if !since.IsZero() {
+		args = append(args, since)
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.display_name, `+value+`
+		FROM users u
+		WHERE u.id IN `+leaderboardMembersSQL("$1"),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []leaderboardEntry
+	for rows.Next() {
+		var e leaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Username, &e.DisplayName, &e.Value); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// streakLeaderboard scores members by their current streak, judged against
+// each member's own journal day. Members without a streaks row yet get theirs
+// built first, as loadStreak does.
+func streakLeaderboard(db *sql.DB, viewerID int) ([]leaderboardEntry, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.display_name, COALESCE(u.timezone, 'UTC'),
+		       s.user_id IS NOT NULL,
+		       COALESCE(s.streak_count, 0), COALESCE(s.longest_streak, 0), s.last_post_date,
+		       COALESCE(s.freezes_available, 0), COALESCE(s.freezes_used, 0)
+		FROM users u
+		LEFT JOIN streaks s ON s.user_id = u.id
+		WHERE u.id IN `+leaderboardMembersSQL("$1"),
+		viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type member struct {
+		timezone string
+		tracked  bool
+		state    streakState
+	}
+	var entries []leaderboardEntry
+	var members []member
+	for rows.Next() {
+		var e leaderboardEntry
+		var m member
+		var lastPostDate sql.NullTime
+		err := rows.Scan(&e.UserID, &e.Username, &e.DisplayName, &m.timezone, &m.tracked,
+			&m.state.count, &m.state.longest, &lastPostDate, &m.state.freezes, &m.state.freezesUsed)
+		if err != nil {
+			return nil, err
+		}
+		if lastPostDate.Valid {
+			m.state.lastPostDate = lastPostDate.Time.UTC()
+		}
+		entries = append(entries, e)
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	now := time.Now().UTC()
+	for i, m := range members {
+		if !m.tracked {
+			if m.state, err = buildStreak(db, entries[i].UserID); err != nil {
+				return nil, err
+			}
+		}
+
+		today, err := ComputeJournalDate(now, m.timezone)
+		if err != nil {
+			today, _ = ComputeJournalDate(now, "UTC")
+		}
+		entries[i].Value = m.state.asOf(entries[i].UserID, today).CurrentStreak
+	}
+	return entries, nil
+}
+
+// rankLeaderboard sorts entries by value, highest first, and ranks them so
+// that ties share a rank (1, 2, 2, 4).
+func rankLeaderboard(entries []leaderboardEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	for i := range entries {
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+}
+
+// UpdateLeaderboardSettings lets the authenticated user hide from other
+// people's leaderboards. They still see themselves on their own.
+func UpdateLeaderboardSettings(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			OptOut bool `json:"opt_out"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = db.Exec(`UPDATE users SET leaderboard_opt_out = $1 WHERE id = $2`, req.OptOut, userID)
+		if err != nil {
+			http.Error(w, "Failed to update leaderboard setting", http.StatusInternalServerError)
+			log.Println("UpdateLeaderboardSettings error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Leaderboard setting updated",
+			"opt_out": req.OptOut,
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+const (
+	mailLockDuration        = 2 * time.Minute
+	mailSendTimeout         = 30 * time.Second
+	mailDefaultPollInterval = 2 * time.Second
+	mailClaimBatch          = 10
+)
+
+// queueMail renders tm and stores it in mail_queue for the MailSender. Pass
+// a transaction to queue the mail only if the surrounding write commits. A
+// non-empty idempotencyKey makes queueing the same mail twice a no-op.
+func queueMail(q queryer, mailSvc *services.MailService, idempotencyKey string, tm services.TemplatedMail) error {
+	if mailSvc == nil {
+		return errors.New("mail service is not configured")
+	}
+
+	msg, err := mailSvc.Compose(tm)
+	if err != nil {
+		return err
+	}
+
+	var key, unsubscribe sql.NullString
+	if idempotencyKey != "" {
+		key = sql.NullString{String: idempotencyKey, Valid: true}
+	}
+	if msg.UnsubscribeURL != "" {
+		unsubscribe = sql.NullString{String: msg.UnsubscribeURL, Valid: true}
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO mail_queue (idempotency_key, template, recipient, subject, text_body, html_body, unsubscribe_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (idempotency_key) DO NOTHING`,
+		key, tm.Template, msg.To, msg.Subject, msg.Text, msg.HTML, unsubscribe)
+	return err
+}
+
+type queuedMail struct {
+	ID          int64
+	Template    string
+	Attempts    int
+	MaxAttempts int
+	Msg         services.OutgoingMail
+}
+
+// MailSender delivers queued mail in the background, retrying temporary
+// failures with backoff. Mail the receiving server rejects permanently is
+// marked bounced and mail that runs out of attempts is marked failed; both
+// stay in the table for admins to inspect.
+type MailSender struct {
+	db           *sql.DB
+	mail         *services.MailService
+	pollInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewMailSender(db *sql.DB, mailSvc *services.MailService) *MailSender {
+	return &MailSender{
+		db:           db,
+		mail:         mailSvc,
+		pollInterval: mailDefaultPollInterval,
+	}
+}
+
+func (s *MailSender) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.poll(ctx)
+	}()
+
+	log.Println("[Mail] Sender started")
+}
+
+// Stop stops claiming new mail and waits for the current batch to finish.
+func (s *MailSender) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	log.Println("[Mail] Sender stopped")
+}
+
+func (s *MailSender) poll(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		batch, err := s.claim(mailClaimBatch)
+		if err != nil {
+			log.Printf("[Mail] Claim error: %v", err)
+		}
+
+		// Mail that was claimed is sent even during shutdown; an SMTP
+		// session cut short would only be retried after its lock expires.
+		for _, m := range batch {
+			s.process(m)
+		}
+
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.pollInterval):
+			}
+		}
+	}
+}
+
+// claim locks up to limit due messages, including ones stuck in sending past
+// their lock because the process died mid-send.
+func (s *MailSender) claim(limit int) ([]queuedMail, error) {
+	rows, err := s.db.Query(`
+		UPDATE mail_queue
+		SET status = 'sending',
+		    attempts = attempts + 1,
+		    locked_until = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM mail_queue
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			   OR (status = 'sending' AND locked_until < NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, recipient, subject, text_body, html_body,
+		          COALESCE(unsubscribe_url, ''), attempts, max_attempts`,
+		limit, int(mailLockDuration.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []queuedMail
+	for rows.Next() {
+		var m queuedMail
+		if err := rows.Scan(&m.ID, &m.Template, &m.Msg.To, &m.Msg.Subject, &m.Msg.Text, &m.Msg.HTML,
+			&m.Msg.UnsubscribeURL, &m.Attempts, &m.MaxAttempts); err != nil {
+			return batch, err
+		}
+		batch = append(batch, m)
+	}
+	return batch, rows.Err()
+}
+
+func (s *MailSender) process(m queuedMail) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	err := s.mail.Deliver(ctx, m.Msg)
+	cancel()
+
+	if err == nil {
+		_, err = s.db.Exec(`
+			UPDATE mail_queue
+			SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL
+			WHERE id = $1`,
+			m.ID)
+		if err != nil {
+			log.Printf("[Mail] Failed to mark mail %d sent: %v", m.ID, err)
+		}
+		return
+	}
+
+	status := ""
+	switch {
+	case services.IsPermanentMailError(err):
+		status = "bounced"
+	case m.Attempts >= m.MaxAttempts:
+		status = "failed"
+	}
+	if status != "" {
+		log.Printf("[Mail] %s to %s %s after %d attempts: %v", m.Template, m.Msg.To, status, m.Attempts, err)
+		_, dbErr := s.db.Exec(`
+			UPDATE mail_queue
+			SET status = $2, locked_until = NULL, last_error = $3
+			WHERE id = $1`,
+			m.ID, status, err.Error())
+		if dbErr != nil {
+			log.Printf("[Mail] Failed to mark mail %d %s: %v", m.ID, status, dbErr)
+		}
+		return
+	}
+
+	delay := outboxBackoff(m.Attempts)
+	log.Printf("[Mail] %s to %s attempt %d failed, retrying in %s: %v",
+		m.Template, m.Msg.To, m.Attempts, delay, err)
+	_, dbErr := s.db.Exec(`
+		UPDATE mail_queue
+		SET status = 'pending',
+		    locked_until = NULL,
+		    last_error = $2,
+		    next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1`,
+		m.ID, err.Error(), delay.Milliseconds())
+	if dbErr != nil {
+		log.Printf("[Mail] Failed to reschedule mail %d: %v", m.ID, dbErr)
+	}
+}
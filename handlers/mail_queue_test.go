@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// queueTestMail adds a mail_queue row as claim would leave it, on its
+// attempts-th attempt, and removes it when the test ends.
+func queueTestMail(t *testing.T, db *sql.DB, to string, attempts, maxAttempts int) queuedMail {
+	t.Helper()
+	m := queuedMail{
+		Template:    "test",
+		Attempts:    attempts,
+		MaxAttempts: maxAttempts,
+		Msg:         services.OutgoingMail{To: to, Subject: "Hello", Text: "Hello", HTML: "<p>Hello</p>"},
+	}
+	err := db.QueryRow(`
+		INSERT INTO mail_queue (template, recipient, subject, text_body, html_body, status, attempts, max_attempts, locked_until)
+		VALUES ($1, $2, $3, $4, $5, 'sending', $6, $7, NOW() + INTERVAL '2 minutes')
+		RETURNING id`,
+		m.Template, to, m.Msg.Subject, m.Msg.Text, m.Msg.HTML, attempts, maxAttempts).Scan(&m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM mail_queue WHERE id = $1`, m.ID) })
+	return m
+}
+
+func TestMailSenderProcess(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name      string
+		attempts  int
+		setup     func(tr *services.CaptureTransport, to string)
+		want      string
+		delivered bool
+	}{
+		{name: "sent", attempts: 1, setup: func(*services.CaptureTransport, string) {}, want: "sent", delivered: true},
+		{name: "retry", attempts: 1, setup: func(tr *services.CaptureTransport, to string) { tr.FailNext(to, 1) }, want: "pending"},
+		{name: "bounced", attempts: 1, setup: func(tr *services.CaptureTransport, to string) { tr.Reject(to) }, want: "bounced"},
+		{name: "failed", attempts: 3, setup: func(tr *services.CaptureTransport, to string) { tr.FailNext(to, 1) }, want: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := services.NewCaptureTransport()
+			mailSvc, err := services.NewMailServiceWithTransport(services.Config{From: "journal@example.com"}, transport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender := NewMailSender(db, mailSvc)
+
+			to := fmt.Sprintf("%s-%d@example.com", tt.name, time.Now().UnixNano())
+			tt.setup(transport, to)
+			m := queueTestMail(t, db, to, tt.attempts, 3)
+
+			sender.process(m)
+
+			var status string
+			var lockedUntil sql.NullTime
+			var lastError sql.NullString
+			var retryAt time.Time
+			err = db.QueryRow(`
+				SELECT status, locked_until, last_error, next_attempt_at
+				FROM mail_queue WHERE id = $1`,
+				m.ID).Scan(&status, &lockedUntil, &lastError, &retryAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != tt.want {
+				t.Errorf("status = %q, want %q", status, tt.want)
+			}
+			if lockedUntil.Valid {
+				t.Error("mail is still locked")
+			}
+			if delivered := len(transport.Sent()) == 1; delivered != tt.delivered {
+				t.Errorf("delivered = %v, want %v", delivered, tt.delivered)
+			}
+			if !tt.delivered && !lastError.Valid {
+				t.Error("last_error is not recorded")
+			}
+			if tt.want == "pending" && !retryAt.After(time.Now()) {
+				t.Errorf("retry scheduled at %s, want a backoff into the future", retryAt)
+			}
+		})
+	}
+}
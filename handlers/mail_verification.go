@@ -175,19 +175,36 @@ func ResendVerificationEmailHandler(db *sql.DB, mailSvc *services.MailService) h
 	}
 }
 
+// sendVerificationEmail replaces the user's verification token and queues
+// the email carrying the new one.
 func sendVerificationEmail(db *sql.DB, mailSvc *services.MailService, userID int, email string) error {
-	_, err := db.Exec(`DELETE FROM email_verifications WHERE user_id = $1`, userID)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM email_verifications WHERE user_id = $1`, userID)
 	if err != nil {
 		return fmt.Errorf("failed to clear old tokens: %w", err)
 	}
 	token := generateSecureToken()
 	expiresAt := time.Now().Add(24 * time.Hour)
-	_, err = db.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO email_verifications (user_id, token, expires_at)
 		VALUES ($1, $2, $3)
 	`, userID, token, expiresAt)
 	if err != nil {
 		return fmt.Errorf("failed to store token: %w", err)
 	}
-	return mailSvc.SendVerificationEmail(email, token)
+
+	var locale string
+	if err := tx.QueryRow(`SELECT locale FROM users WHERE id = $1`, userID).Scan(&locale); err != nil {
+		return fmt.Errorf("failed to fetch locale: %w", err)
+	}
+
+	if err := queueMail(tx, mailSvc, "", mailSvc.VerificationMail(email, locale, token)); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masterboxer.com/project-micro-journal/models"
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// memoriesType is both the opt-in morning reminder and its notification type.
+const memoriesType = "memories"
+
+// memory kinds are years_ago, six_months_ago and month_ago, by how far back
+// the entry was written.
+const memoryYearsAgo = "years_ago"
+
+type memory struct {
+	Kind string `json:"kind"`
+	// YearsAgo is set for years_ago memories.
+	YearsAgo int         `json:"years_ago,omitempty"`
+	Post     models.Post `json:"post"`
+}
+
+// calendarToday is the user's local calendar date as UTC midnight, the form
+// journal dates take. Unlike the journal date it turns over at midnight, so
+// the morning push looks back from the day that has just begun.
+func calendarToday(nowUTC time.Time, timezone string) time.Time {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := nowUTC.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// loadMemories returns the user's entries from the same calendar day as today
+// in earlier years, and from one and six months ago, newest first. Month
+// arithmetic clamps to the end of shorter months, as Postgres does. Deleted
+// posts are gone from posts, so they can never resurface.
+func loadMemories(q queryer, userID int, today time.Time) ([]memory, error) {
+	rows, err := q.Query(`
+		SELECT p.id, p.user_id, p.template_id, p.text, COALESCE(p.photo_path, ''),
+		       p.created_at, p.journal_date,
+		       CASE
+		           WHEN p.journal_date = ($2::date - INTERVAL '1 month')::date THEN 'month_ago'
+		           WHEN p.journal_date = ($2::date - INTERVAL '6 months')::date THEN 'six_months_ago'
+		           ELSE 'years_ago'
+		       END
+		FROM posts p
+		WHERE p.user_id = $1
+		  AND p.journal_date < $2::date
+		  AND (p.journal_date = ($2::date - INTERVAL '1 month')::date
+		       OR p.journal_date = ($2::date - INTERVAL '6 months')::date
+		       OR (EXTRACT(MONTH FROM p.journal_date) = EXTRACT(MONTH FROM $2::date)
+		           AND EXTRACT(DAY FROM p.journal_date) = EXTRACT(DAY FROM $2::date)))
+		ORDER BY p.journal_date DESC`,
+		userID, today)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memories := []memory{}
+	for rows.Next() {
+		var m memory
+		p := &m.Post
+		err := rows.Scan(&p.ID, &p.UserID, &p.TemplateID, &p.Text, &p.PhotoPath,
+			&p.CreatedAt, &p.JournalDate, &m.Kind)
+		if err != nil {
+			return nil, err
+		}
+		if m.Kind == memoryYearsAgo {
+			m.YearsAgo = today.Year() - p.JournalDate.UTC().Year()
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// GetTodayMemories returns the authenticated user's memories for their local
+// calendar date. Users who turned resurfacing off get none.
+func GetTodayMemories(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var timezone string
+		var optOut bool
+		err = db.QueryRow(`
+			SELECT COALESCE(timezone, 'UTC'), memories_opt_out
+			FROM users WHERE id = $1`,
+			userID).Scan(&timezone, &optOut)
+		if err != nil {
+			http.Error(w, "Failed to fetch memories", http.StatusInternalServerError)
+			log.Println("GetTodayMemories user error:", err)
+			return
+		}
+
+		today := calendarToday(time.Now().UTC(), timezone)
+
+		memories := []memory{}
+		if !optOut {
+			memories, err = loadMemories(db, userID, today)
+			if err != nil {
+				http.Error(w, "Failed to fetch memories", http.StatusInternalServerError)
+				log.Println("GetTodayMemories query error:", err)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"date":     today.Format("2006-01-02"),
+			"enabled":  !optOut,
+			"memories": memories,
+		})
+	}
+}
+
+// UpdateMemorySettings lets the authenticated user turn resurfacing off,
+// which also silences the morning memories push.
+func UpdateMemorySettings(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			OptOut bool `json:"opt_out"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = db.Exec(`UPDATE users SET memories_opt_out = $1 WHERE id = $2`, req.OptOut, userID)
+		if err != nil {
+			http.Error(w, "Failed to update memories setting", http.StatusInternalServerError)
+			log.Println("UpdateMemorySettings error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Memories setting updated",
+			"opt_out": req.OptOut,
+		})
+	}
+}
+
+// SendMemoriesNotifications sends the morning memories push to users who
+// turned it on, on days they have memories to look back on.
+func SendMemoriesNotifications(ctx context.Context, db *sql.DB, push services.PushSender) error {
+	return processDueReminders(ctx, db, memoriesType, "[Memories]",
+		func(userID int, timezone string, nowUTC time.Time) (bool, error) {
+			var optOut bool
+			err := db.QueryRow(`SELECT memories_opt_out FROM users WHERE id = $1`, userID).Scan(&optOut)
+			if err != nil {
+				return false, err
+			}
+			if optOut {
+				return false, nil
+			}
+
+			today := calendarToday(nowUTC, timezone)
+			memories, err := loadMemories(db, userID, today)
+			if err != nil {
+				return false, err
+			}
+			if len(memories) == 0 {
+				return false, nil
+			}
+
+			body := "You have a memory to look back on today."
+			if len(memories) > 1 {
+				body = fmt.Sprintf("You have %d memories to look back on today.", len(memories))
+			}
+			success, failure, err := sendPush(
+				db,
+				push,
+				userID,
+				memoriesType,
+				"On this day 📖",
+				body,
+				map[string]string{
+					"type":    memoriesType,
+					"user_id": strconv.Itoa(userID),
+					"date":    today.Format("2006-01-02"),
+				},
+				memoriesType,
+			)
+			if err != nil {
+				return false, err
+			}
+
+			log.Printf("[Memories] User %d → %d memories, %d sent, %d failed", userID, len(memories), success, failure)
+			return success > 0, nil
+		})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// An @ only starts a mention at the beginning of the text or after a character
+// that can't be part of a username, so e-mail addresses aren't picked up.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@])@([A-Za-z0-9_.]{1,30})`)
+
+func extractMentions(text string) []string {
+	seen := make(map[string]bool)
+	var usernames []string
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := strings.ToLower(strings.TrimRight(match[1], "."))
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+
+	return usernames
+}
+
+// saveMentions resolves the @usernames in text and stores a mention row for
+// each user who is allowed to see the post. For posts (commentID == nil) the
+// stored set is replaced, so mentions removed by an edit are dropped. It
+// returns only the users who were newly mentioned.
+func saveMentions(q queryer, postID int, commentID *int, authorID int, text string) ([]int, error) {
+	usernames := extractMentions(text)
+
+	var postOwnerID int
+	err := q.QueryRow(`SELECT user_id FROM posts WHERE id = $1`, postID).Scan(&postOwnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch post owner: %w", err)
+	}
+
+	// Never nil: pq.Array(nil) is NULL, and "!= ALL(NULL)" below would then
+	// keep every old mention.
+	candidateIDs := []int64{}
+	if len(usernames) > 0 {
+		rows, err := q.Query(`
+			SELECT u.id
+			FROM users u
+			WHERE LOWER(u.username) = ANY($1)
+			  AND u.id != $2
+			  AND u.id NOT IN `+blockedUsersSQL("$2")+`
+			  AND (
+				u.id = $3
+				OR EXISTS (
+					SELECT 1 FROM followers f
+					WHERE f.status = 'accepted'
+					  AND ((f.follower_id = u.id AND f.following_id = $3)
+					    OR (f.follower_id = $3 AND f.following_id = u.id))
+				)
+			  )`,
+			pq.Array(usernames), authorID, postOwnerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve mentions: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, fmt.Errorf("failed to scan mention: %w", err)
+			}
+			candidateIDs = append(candidateIDs, id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var insertRows *sql.Rows
+	if commentID == nil {
+		_, err = q.Exec(`
+			DELETE FROM mentions
+			WHERE post_id = $1
+			  AND comment_id IS NULL
+			  AND mentioned_user_id != ALL($2)`,
+			postID, pq.Array(candidateIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to clear old mentions: %w", err)
+		}
+
+		if len(candidateIDs) == 0 {
+			return nil, nil
+		}
+
+		insertRows, err = q.Query(`
+			INSERT INTO mentions (post_id, mentioner_id, mentioned_user_id)
+			SELECT $1, $2, UNNEST($3::int[])
+			ON CONFLICT (post_id, mentioned_user_id) WHERE comment_id IS NULL DO NOTHING
+			RETURNING mentioned_user_id`,
+			postID, authorID, pq.Array(candidateIDs))
+	} else {
+		if len(candidateIDs) == 0 {
+			return nil, nil
+		}
+
+		insertRows, err = q.Query(`
+			INSERT INTO mentions (post_id, comment_id, mentioner_id, mentioned_user_id)
+			SELECT $1, $2, $3, UNNEST($4::int[])
+			ON CONFLICT (comment_id, mentioned_user_id) WHERE comment_id IS NOT NULL DO NOTHING
+			RETURNING mentioned_user_id`,
+			postID, *commentID, authorID, pq.Array(candidateIDs))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store mentions: %w", err)
+	}
+	defer insertRows.Close()
+
+	var newlyMentioned []int
+	for insertRows.Next() {
+		var id int
+		if err := insertRows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan stored mention: %w", err)
+		}
+		newlyMentioned = append(newlyMentioned, id)
+	}
+
+	return newlyMentioned, insertRows.Err()
+}
+
+func notifyMentionedUsers(db *sql.DB, push services.PushSender, eventKey string, postID int, commentID *int, mentionerID int, mentionedUserIDs []int, text string) error {
+	if len(mentionedUserIDs) == 0 {
+		return nil
+	}
+
+	mentionerDisplayName := fetchDisplayName(db, mentionerID, "Someone")
+
+	title := fmt.Sprintf("%s mentioned you in a post", mentionerDisplayName)
+	if commentID != nil {
+		title = fmt.Sprintf("%s mentioned you in a comment", mentionerDisplayName)
+	}
+
+	// Keep going past failures; the retry skips users already notified.
+	var lastErr error
+	for _, mentionedUserID := range mentionedUserIDs {
+		data := map[string]string{
+			"type":         "mention",
+			"post_id":      strconv.Itoa(postID),
+			"mentioner_id": strconv.Itoa(mentionerID),
+		}
+		if commentID != nil {
+			data["comment_id"] = strconv.Itoa(*commentID)
+		}
+
+		err := deliverNotification(db, push, notification{
+			UserID:     mentionedUserID,
+			ActorID:    mentionerID,
+			Type:       "mention",
+			TargetType: "post",
+			TargetID:   postID,
+			Title:      title,
+			Body:       truncateForPush(text),
+			Data:       data,
+			DedupeKey:  eventKey,
+		})
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
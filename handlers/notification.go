@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+
+	"masterboxer.com/project-micro-journal/services"
 )
 
 func RegisterTokenHandler(db *sql.DB) http.HandlerFunc {
@@ -32,21 +35,18 @@ func RegisterTokenHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := `
-			INSERT INTO fcm_tokens (user_id, token, created_at, updated_at)
-			VALUES ($1, $2, NOW(), NOW())
-			ON CONFLICT (user_id, token) 
-			DO UPDATE SET updated_at = NOW()`
-
-		_, err := db.Exec(query, req.UserID, req.Token)
+		if msg := req.normalize(); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
 
-		if err != nil {
+		if err := saveDeviceToken(db, req); err != nil {
 			log.Printf("Database error saving FCM token: %v", err)
 			http.Error(w, "Failed to register token", http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("✅ FCM token registered for user %d", req.UserID)
+		log.Printf("✅ %s token registered for user %d", req.Provider, req.UserID)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -55,3 +55,59 @@ func RegisterTokenHandler(db *sql.DB) http.HandlerFunc {
 		})
 	}
 }
+
+// normalize fills in the default provider and validates platform and
+// provider, returning a message for the client when they are invalid.
+func (req *TokenRequest) normalize() string {
+	req.Platform = strings.ToLower(strings.TrimSpace(req.Platform))
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+
+	switch req.Platform {
+	case "", "android", "ios", "web":
+	default:
+		return "platform must be android, ios or web"
+	}
+
+	if req.Provider == "" {
+		req.Provider = services.ProviderFCM
+		if req.Platform == "web" {
+			req.Provider = services.ProviderWebPush
+		}
+	}
+	if !services.IsPushProvider(req.Provider) {
+		return "provider must be fcm, apns or webpush"
+	}
+
+	return ""
+}
+
+// saveDeviceToken registers the token, refreshing its platform and provider
+// if it was registered before.
+func saveDeviceToken(db *sql.DB, req TokenRequest) error {
+	_, err := db.Exec(`
+		INSERT INTO fcm_tokens (user_id, token, platform, provider, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NOW(), NOW())
+		ON CONFLICT (user_id, token)
+		DO UPDATE SET platform = COALESCE(EXCLUDED.platform, fcm_tokens.platform),
+		              provider = EXCLUDED.provider,
+		              updated_at = NOW()`,
+		req.UserID, req.Token, req.Platform, req.Provider)
+	return err
+}
+
+// GetVAPIDPublicKey returns the application server key browsers need to
+// subscribe to Web Push.
+func GetVAPIDPublicKey(push services.PushSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyed, ok := push.(interface{ VAPIDPublicKey() string })
+		if !ok || keyed.VAPIDPublicKey() == "" {
+			http.Error(w, "Web Push is not configured", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"public_key": keyed.VAPIDPublicKey(),
+		})
+	}
+}
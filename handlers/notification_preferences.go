@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// notificationTypes lists every notification type a user can configure.
+var notificationTypes = []string{
+	"new_follower",
+	"follow_request",
+	"follow_accepted",
+	"mention",
+	"new_post",
+	"post_reaction",
+	"post_comment",
+	"daily_reminder",
+	"score_decay_warning",
+	achievementNotificationType,
+	pactInvite,
+	pactAccepted,
+	pactNudge,
+	digestType,
+	memoriesType,
+}
+
+// Reminders are only useful at the moment they fire, so a reminder that lands
+// in quiet hours is dropped instead of being deferred to the morning.
+var undeferrableTypes = map[string]bool{
+	"daily_reminder":      true,
+	"score_decay_warning": true,
+	pactNudge:             true,
+}
+
+type channelPreference struct {
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+	InApp bool `json:"in_app"`
+}
+
+var defaultChannelPreference = channelPreference{Push: true, Email: false, InApp: true}
+
+// channelDefaults overrides defaultChannelPreference for types that don't fit
+// it. The weekly digest only exists as an email, which users opt in to.
+var channelDefaults = map[string]channelPreference{
+	digestType: {Push: false, Email: false, InApp: false},
+}
+
+func defaultPreferenceFor(notifType string) channelPreference {
+	if pref, ok := channelDefaults[notifType]; ok {
+		return pref
+	}
+	return defaultChannelPreference
+}
+
+func isNotificationType(t string) bool {
+	for _, known := range notificationTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+func loadChannelPreference(db *sql.DB, userID int, notifType string) (channelPreference, error) {
+	pref := defaultPreferenceFor(notifType)
+	err := db.QueryRow(`
+		SELECT push, email, in_app
+		FROM notification_preferences
+		WHERE user_id = $1 AND type = $2`,
+		userID, notifType).Scan(&pref.Push, &pref.Email, &pref.InApp)
+	if err == sql.ErrNoRows {
+		return defaultPreferenceFor(notifType), nil
+	}
+	return pref, err
+}
+
+// quietHoursEnd reports whether now falls inside the user's quiet hours and,
+// if so, the instant (in UTC) at which they end.
+func quietHoursEnd(db *sql.DB, userID int, now time.Time) (*time.Time, error) {
+	var timezone string
+	var start, end sql.NullString
+	err := db.QueryRow(`
+		SELECT COALESCE(timezone, 'UTC'),
+		       to_char(quiet_hours_start, 'HH24:MI'),
+		       to_char(quiet_hours_end, 'HH24:MI')
+		FROM users
+		WHERE id = $1`,
+		userID).Scan(&timezone, &start, &end)
+	if err != nil {
+		return nil, err
+	}
+
+	if !start.Valid || !end.Valid || start.String == end.String {
+		return nil, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	startClock, err := time.Parse("15:04", start.String)
+	if err != nil {
+		return nil, err
+	}
+	endClock, err := time.Parse("15:04", end.String)
+	if err != nil {
+		return nil, err
+	}
+
+	localNow := now.In(loc)
+	minuteOfDay := localNow.Hour()*60 + localNow.Minute()
+	startMinute := startClock.Hour()*60 + startClock.Minute()
+	endMinute := endClock.Hour()*60 + endClock.Minute()
+
+	var quiet bool
+	if startMinute < endMinute {
+		quiet = minuteOfDay >= startMinute && minuteOfDay < endMinute
+	} else {
+		// The window wraps past midnight, e.g. 22:00–07:00.
+		quiet = minuteOfDay >= startMinute || minuteOfDay < endMinute
+	}
+	if !quiet {
+		return nil, nil
+	}
+
+	until := time.Date(localNow.Year(), localNow.Month(), localNow.Day(),
+		endClock.Hour(), endClock.Minute(), 0, 0, loc)
+	if !until.After(localNow) {
+		until = until.AddDate(0, 0, 1)
+	}
+	until = until.UTC()
+
+	return &until, nil
+}
+
+// sendPush is the single gate every push goes through. It honours the user's
+// push preference for notifType and defers (or, for reminders, drops) pushes
+// that would land in their quiet hours. Pushes sharing a non-empty collapseKey
+// replace one another, both on the device and while deferred.
+func sendPush(db *sql.DB, push services.PushSender, userID int, notifType, title, body string, data map[string]string, collapseKey string) (int, int, error) {
+	pref, err := loadChannelPreference(db, userID, notifType)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load preferences: %w", err)
+	}
+	if !pref.Push {
+		log.Printf("[Push] User %d disabled %s pushes, skipping", userID, notifType)
+		return 0, 0, nil
+	}
+
+	until, err := quietHoursEnd(db, userID, time.Now().UTC())
+	if err != nil {
+		log.Printf("[Push] Quiet hours check failed for user %d: %v", userID, err)
+	}
+	if until != nil {
+		if undeferrableTypes[notifType] {
+			log.Printf("[Push] User %d in quiet hours, dropping %s", userID, notifType)
+			return 0, 0, nil
+		}
+
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if collapseKey != "" {
+			_, err = db.Exec(`
+				DELETE FROM deferred_pushes
+				WHERE user_id = $1 AND collapse_key = $2`,
+				userID, collapseKey)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to collapse deferred push: %w", err)
+			}
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO deferred_pushes (user_id, type, title, body, payload, deliver_after, collapse_key)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`,
+			userID, notifType, title, body, string(payload), *until, collapseKey)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to defer push: %w", err)
+		}
+
+		log.Printf("[Push] User %d in quiet hours, deferred %s until %s",
+			userID, notifType, until.Format(time.RFC3339))
+		return 0, 0, nil
+	}
+
+	return pushToDevices(db, push, userID, title, body, data, collapseKey)
+}
+
+// A deferred push whose send fails is retried after deferredPushRetryDelay,
+// up to deferredPushMaxAttempts times in all.
+const (
+	deferredPushRetryDelay  = 5 * time.Minute
+	deferredPushMaxAttempts = 5
+)
+
+// FlushDeferredPushes delivers pushes held back by quiet hours once their
+// window has ended. Each push is claimed by moving deliver_after past the
+// retry delay, and only deleted once it has been sent (or has run out of
+// attempts), so a failed or interrupted send is picked up again later; that
+// includes pushes left unsent because ctx was done.
+func FlushDeferredPushes(ctx context.Context, db *sql.DB, push services.PushSender) error {
+	log.Println("[DeferredPush] Job started")
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE deferred_pushes
+		SET deliver_after = NOW() + $1 * INTERVAL '1 second', attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM deferred_pushes
+			WHERE deliver_after <= NOW()
+			ORDER BY deliver_after
+			LIMIT 500
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, attempts, user_id, type, title, body, payload, COALESCE(collapse_key, '')`,
+		int(deferredPushRetryDelay.Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to claim deferred pushes: %w", err)
+	}
+
+	type deferredPush struct {
+		id          int64
+		attempts    int
+		userID      int
+		notifType   string
+		title, body string
+		data        map[string]string
+		collapseKey string
+	}
+
+	var pushes []deferredPush
+	for rows.Next() {
+		var p deferredPush
+		var payload []byte
+		if err := rows.Scan(&p.id, &p.attempts, &p.userID, &p.notifType, &p.title, &p.body, &payload, &p.collapseKey); err != nil {
+			log.Printf("[DeferredPush] Scan error: %v", err)
+			continue
+		}
+		if err := json.Unmarshal(payload, &p.data); err != nil {
+			log.Printf("[DeferredPush] Bad payload for user %d: %v", p.userID, err)
+		}
+		pushes = append(pushes, p)
+	}
+	rows.Close()
+
+	var sent, retrying int
+	for _, p := range pushes {
+		if err := ctx.Err(); err != nil {
+			log.Printf("[DeferredPush] Job stopped | Sent %d notifications, %d to retry", sent, retrying)
+			return err
+		}
+
+		success, failure, err := pushToDevices(db, push, p.userID, p.title, p.body, p.data, p.collapseKey)
+		if err == nil && success == 0 && failure > 0 {
+			err = fmt.Errorf("all %d devices failed", failure)
+		}
+		if err != nil && p.attempts < deferredPushMaxAttempts {
+			log.Printf("[DeferredPush] Error sending %s to user %d (attempt %d), will retry: %v",
+				p.notifType, p.userID, p.attempts, err)
+			retrying++
+			continue
+		}
+		if err != nil {
+			log.Printf("[DeferredPush] Giving up on %s to user %d after %d attempts: %v",
+				p.notifType, p.userID, p.attempts, err)
+		}
+		sent += success
+
+		if _, err := db.ExecContext(ctx, `DELETE FROM deferred_pushes WHERE id = $1`, p.id); err != nil {
+			log.Printf("[DeferredPush] Failed to remove push %d: %v", p.id, err)
+		}
+	}
+
+	log.Printf("[DeferredPush] Job finished | Claimed %d pushes, sent %d notifications, %d to retry",
+		len(pushes), sent, retrying)
+	return nil
+}
+
+type notificationSettings struct {
+	Timezone    string                       `json:"timezone"`
+	QuietHours  *quietHours                  `json:"quiet_hours"`
+	Preferences map[string]channelPreference `json:"preferences"`
+}
+
+type quietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func loadNotificationSettings(db *sql.DB, userID int) (*notificationSettings, error) {
+	settings := &notificationSettings{
+		Preferences: make(map[string]channelPreference, len(notificationTypes)),
+	}
+
+	var start, end sql.NullString
+	err := db.QueryRow(`
+		SELECT COALESCE(timezone, 'UTC'),
+		       to_char(quiet_hours_start, 'HH24:MI'),
+		       to_char(quiet_hours_end, 'HH24:MI')
+		FROM users
+		WHERE id = $1`,
+		userID).Scan(&settings.Timezone, &start, &end)
+	if err != nil {
+		return nil, err
+	}
+	if start.Valid && end.Valid {
+		settings.QuietHours = &quietHours{Start: start.String, End: end.String}
+	}
+
+	for _, t := range notificationTypes {
+		settings.Preferences[t] = defaultPreferenceFor(t)
+	}
+
+	rows, err := db.Query(`
+		SELECT type, push, email, in_app
+		FROM notification_preferences
+		WHERE user_id = $1`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var pref channelPreference
+		if err := rows.Scan(&t, &pref.Push, &pref.Email, &pref.InApp); err != nil {
+			return nil, err
+		}
+		if isNotificationType(t) {
+			settings.Preferences[t] = pref
+		}
+	}
+
+	return settings, rows.Err()
+}
+
+func GetNotificationSettings(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		settings, err := loadNotificationSettings(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch notification settings", http.StatusInternalServerError)
+			log.Println("GetNotificationSettings error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+func UpdateNotificationSettings(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// quiet_hours is kept raw so an explicit null (turn quiet hours off)
+		// can be told apart from the field being left out.
+		var req struct {
+			QuietHours  json.RawMessage `json:"quiet_hours"`
+			Preferences map[string]struct {
+				Push  *bool `json:"push"`
+				Email *bool `json:"email"`
+				InApp *bool `json:"in_app"`
+			} `json:"preferences"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		for t := range req.Preferences {
+			if !isNotificationType(t) {
+				http.Error(w, "Unknown notification type: "+t, http.StatusBadRequest)
+				return
+			}
+		}
+
+		var qh *quietHours
+		updateQuietHours := len(req.QuietHours) > 0
+		if updateQuietHours && string(req.QuietHours) != "null" {
+			qh = &quietHours{}
+			if err := json.Unmarshal(req.QuietHours, qh); err != nil {
+				http.Error(w, "Invalid quiet_hours", http.StatusBadRequest)
+				return
+			}
+			if _, err := time.Parse("15:04", qh.Start); err != nil {
+				http.Error(w, "quiet_hours.start must be HH:MM", http.StatusBadRequest)
+				return
+			}
+			if _, err := time.Parse("15:04", qh.End); err != nil {
+				http.Error(w, "quiet_hours.end must be HH:MM", http.StatusBadRequest)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if updateQuietHours {
+			var start, end *string
+			if qh != nil {
+				start, end = &qh.Start, &qh.End
+			}
+			_, err = tx.Exec(`
+				UPDATE users
+				SET quiet_hours_start = $1::time, quiet_hours_end = $2::time
+				WHERE id = $3`,
+				start, end, userID)
+			if err != nil {
+				http.Error(w, "Failed to update quiet hours", http.StatusInternalServerError)
+				log.Println("UpdateNotificationSettings quiet hours error:", err)
+				return
+			}
+		}
+
+		for t, p := range req.Preferences {
+			def := defaultPreferenceFor(t)
+			_, err = tx.Exec(`
+				INSERT INTO notification_preferences (user_id, type, push, email, in_app)
+				VALUES ($1, $2, COALESCE($3, $6), COALESCE($4, $7), COALESCE($5, $8))
+				ON CONFLICT (user_id, type) DO UPDATE SET
+					push = COALESCE($3, notification_preferences.push),
+					email = COALESCE($4, notification_preferences.email),
+					in_app = COALESCE($5, notification_preferences.in_app),
+					updated_at = NOW()`,
+				userID, t, p.Push, p.Email, p.InApp,
+				def.Push, def.Email, def.InApp)
+			if err != nil {
+				http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+				log.Println("UpdateNotificationSettings preference error:", err)
+				return
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		settings, err := loadNotificationSettings(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch notification settings", http.StatusInternalServerError)
+			log.Println("UpdateNotificationSettings reload error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
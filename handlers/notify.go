@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+type notification struct {
+	UserID     int
+	ActorID    int // 0 when the notification has no actor
+	Type       string
+	TargetType string
+	TargetID   int
+	Title      string
+	Body       string
+	Data       map[string]string
+
+	// GroupKey, when set, folds this notification into a recent unread one
+	// with the same key instead of adding a new row. GroupTitle then renders
+	// the title for the combined notification given how many other actors
+	// are in it.
+	GroupKey   string
+	GroupTitle func(others int) string
+
+	// DedupeKey identifies the event that caused this notification. A second
+	// delivery with the same key to the same user is skipped.
+	DedupeKey string
+}
+
+var errAlreadyDelivered = errors.New("notification already delivered")
+
+// Unread notifications younger than this absorb new events with the same
+// group key; after that a fresh notification is started.
+const notificationGroupWindow = 6 * time.Hour
+
+// andOthers renders "Asha", "Asha and 1 other" or "Asha and 4 others".
+func andOthers(name string, others int) string {
+	switch others {
+	case 0:
+		return name
+	case 1:
+		return name + " and 1 other"
+	default:
+		return fmt.Sprintf("%s and %d others", name, others)
+	}
+}
+
+// deliverNotification stores n in the recipient's inbox and then pushes it to
+// their devices, queueing an email too for types in emailTypes. The inbox row
+// is written first so the notification survives even when the user has no
+// valid push token. Each channel is skipped if the recipient turned it off for
+// n.Type. Only failing to record the notification
+// is reported; push failures are logged, since the inbox already has it.
+func deliverNotification(db *sql.DB, push services.PushSender, n notification) error {
+	pref, err := loadChannelPreference(db, n.UserID, n.Type)
+	if err != nil {
+		log.Printf("[Notify] Failed to load preferences for user %d: %v", n.UserID, err)
+		pref = defaultPreferenceFor(n.Type)
+	}
+
+	data := make(map[string]string, len(n.Data)+1)
+	for k, v := range n.Data {
+		data[k] = v
+	}
+
+	title := n.Title
+	if pref.InApp {
+		notificationID, storedTitle, err := storeNotification(db, n)
+		if err == errAlreadyDelivered {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store %s notification for user %d: %w", n.Type, n.UserID, err)
+		}
+		title = storedTitle
+		data["notification_id"] = strconv.FormatInt(notificationID, 10)
+	} else if n.DedupeKey != "" {
+		first, err := recordReceipt(db, n)
+		if err != nil {
+			return fmt.Errorf("failed to record %s receipt for user %d: %w", n.Type, n.UserID, err)
+		}
+		if !first {
+			return nil
+		}
+	}
+
+	if pref.Email && emailTypes[n.Type] {
+		if err := enqueueNotificationEmail(db, n, title); err != nil {
+			log.Printf("[Notify] Failed to queue %s email for user %d: %v", n.Type, n.UserID, err)
+		}
+	}
+
+	// Pushes for the same group replace each other on the device.
+	successCount, failureCount, err := sendPush(db, push, n.UserID, n.Type, title, n.Body, data, n.GroupKey)
+	if err != nil {
+		log.Printf("[Notify] Error sending %s push to user %d: %v", n.Type, n.UserID, err)
+		return nil
+	}
+
+	log.Printf("[Notify] Sent %s push to user %d: %d successful, %d failed",
+		n.Type, n.UserID, successCount, failureCount)
+	return nil
+}
+
+// recordReceipt notes that n.DedupeKey has been delivered to n.UserID and
+// reports whether this is the first time.
+func recordReceipt(q queryer, n notification) (bool, error) {
+	result, err := q.Exec(`
+		INSERT INTO notification_receipts (dedupe_key, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (dedupe_key, user_id) DO NOTHING`,
+		n.DedupeKey, n.UserID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// storeNotification writes n to the inbox, merging it into an open group when
+// n.GroupKey matches one. It returns the row's id and its current title.
+func storeNotification(db *sql.DB, n notification) (int64, string, error) {
+	payload, err := json.Marshal(n.Data)
+	if err != nil {
+		log.Printf("[Notify] Failed to encode payload for user %d: %v", n.UserID, err)
+		payload = []byte("{}")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	if n.DedupeKey != "" {
+		first, err := recordReceipt(tx, n)
+		if err != nil {
+			return 0, "", err
+		}
+		if !first {
+			return 0, "", errAlreadyDelivered
+		}
+	}
+
+	if n.GroupKey != "" {
+		// Serialises concurrent events for the same group so they can't both
+		// miss the open row and start two groups.
+		_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`,
+			strconv.Itoa(n.UserID)+":"+n.GroupKey)
+		if err != nil {
+			return 0, "", err
+		}
+
+		var groupID int64
+		var actorIDs pq.Int64Array
+		err = tx.QueryRow(`
+			SELECT id, actor_ids
+			FROM notifications
+			WHERE user_id = $1
+			  AND group_key = $2
+			  AND read_at IS NULL
+			  AND created_at > $3
+			ORDER BY id DESC
+			LIMIT 1`,
+			n.UserID, n.GroupKey, time.Now().Add(-notificationGroupWindow)).Scan(&groupID, &actorIDs)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, "", err
+		}
+
+		if err == nil {
+			seen := false
+			for _, id := range actorIDs {
+				if id == int64(n.ActorID) {
+					seen = true
+					break
+				}
+			}
+			if !seen && n.ActorID != 0 {
+				actorIDs = append(actorIDs, int64(n.ActorID))
+			}
+
+			title := n.Title
+			if others := len(actorIDs) - 1; others > 0 && n.GroupTitle != nil {
+				title = n.GroupTitle(others)
+			}
+
+			_, err = tx.Exec(`
+				UPDATE notifications
+				SET actor_id = NULLIF($1, 0),
+				    actor_ids = $2,
+				    actor_count = $3,
+				    title = $4,
+				    body = $5,
+				    payload = $6,
+				    updated_at = NOW()
+				WHERE id = $7`,
+				n.ActorID, actorIDs, len(actorIDs), title, n.Body, string(payload), groupID)
+			if err != nil {
+				return 0, "", err
+			}
+
+			return groupID, title, tx.Commit()
+		}
+	}
+
+	actorIDs := pq.Int64Array{}
+	if n.ActorID != 0 {
+		actorIDs = append(actorIDs, int64(n.ActorID))
+	}
+
+	var notificationID int64
+	err = tx.QueryRow(`
+		INSERT INTO notifications (user_id, actor_id, actor_ids, actor_count, type, target_type,
+		                           target_id, title, body, payload, group_key)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), $8, $9, $10, NULLIF($11, ''))
+		RETURNING id`,
+		n.UserID, n.ActorID, actorIDs, len(actorIDs), n.Type, n.TargetType, n.TargetID,
+		n.Title, n.Body, string(payload), n.GroupKey,
+	).Scan(&notificationID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return notificationID, n.Title, tx.Commit()
+}
+
+// pushToDevices sends a push to every registered device of the user without
+// any preference checks; callers should normally go through sendPush. Tokens
+// the provider reports as dead are removed.
+func pushToDevices(db *sql.DB, push services.PushSender, userID int, title, body string, data map[string]string, collapseKey string) (int, int, error) {
+	devices, err := fetchUserDevices(db, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch push tokens: %w", err)
+	}
+
+	if len(devices) == 0 {
+		log.Printf("[Push] No push tokens for user %d", userID)
+		return 0, 0, nil
+	}
+
+	report, err := push.Send(context.Background(), devices, services.PushMessage{
+		Title:       title,
+		Body:        body,
+		Data:        data,
+		CollapseKey: collapseKey,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(report.InvalidTokens) > 0 {
+		_, err := db.Exec(`DELETE FROM fcm_tokens WHERE user_id = $1 AND token = ANY($2)`,
+			userID, pq.Array(report.InvalidTokens))
+		if err != nil {
+			log.Printf("[Push] Failed to delete invalid tokens for user %d: %v", userID, err)
+		} else {
+			log.Printf("[Push] Deleted %d invalid tokens for user %d", len(report.InvalidTokens), userID)
+		}
+	}
+
+	return report.SuccessCount, report.FailureCount, nil
+}
+
+func fetchUserDevices(db *sql.DB, userID int) ([]services.PushDevice, error) {
+	rows, err := db.Query(`
+		SELECT token, provider
+		FROM fcm_tokens
+		WHERE user_id = $1
+		  AND token IS NOT NULL
+		  AND token != ''`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []services.PushDevice
+	for rows.Next() {
+		var d services.PushDevice
+		if err := rows.Scan(&d.Token, &d.Provider); err != nil {
+			log.Printf("Error scanning push token: %v", err)
+			continue
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
+
+func fetchDisplayName(db *sql.DB, userID int, fallback string) string {
+	var displayName string
+	err := db.QueryRow(`SELECT display_name FROM users WHERE id = $1`, userID).Scan(&displayName)
+	if err != nil {
+		log.Printf("Error fetching display name for user %d: %v", userID, err)
+		return fallback
+	}
+	return displayName
+}
+
+// truncateForPush shortens text to at most 100 characters, cutting on rune
+// boundaries so the result stays valid UTF-8.
+func truncateForPush(text string) string {
+	runes := []rune(text)
+	if len(runes) > 100 {
+		return string(runes[:97]) + "..."
+	}
+	return text
+}
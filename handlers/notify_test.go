@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// openTestDB connects to the migrated database in TEST_DATABASE_URL, skipping
+// the test when it isn't set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser adds a user in UTC with the given push tokens, deleted again
+// when the test ends.
+func createTestUser(t *testing.T, db *sql.DB, tokens ...string) int {
+	t.Helper()
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	var userID int
+	err := db.QueryRow(`
+		INSERT INTO users (username, display_name, email, password, dob, timezone, email_verified, created_at)
+		VALUES ($1, $1, $1 || '@example.com', '', '2000-01-01', 'UTC', true, NOW())
+		RETURNING id`,
+		name).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE id = $1`, userID) })
+
+	for _, token := range tokens {
+		_, err := db.Exec(`
+			INSERT INTO fcm_tokens (user_id, token, provider, created_at, updated_at)
+			VALUES ($1, $2, 'fcm', NOW(), NOW())`,
+			userID, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userID
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDeliverNotificationPrunesInvalidTokens(t *testing.T) {
+	db := openTestDB(t)
+	push := services.NewFakePushSender()
+	userID := createTestUser(t, db, "good-token", "stale-token")
+	push.MarkInvalid("stale-token")
+
+	err := deliverNotification(db, push, notification{
+		UserID: userID, Type: "new_follower", Title: "New follower", Body: "Asha followed you",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := push.Sent()
+	if len(sent) != 1 || len(sent[0].Devices) != 2 || sent[0].Message.Title != "New follower" {
+		t.Fatalf("sent = %+v, want one push to both devices", sent)
+	}
+	if sent[0].Message.Data["notification_id"] == "" {
+		t.Error("push is missing the inbox notification_id")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, userID); n != 1 {
+		t.Errorf("inbox has %d notifications, want 1", n)
+	}
+
+	var tokens []string
+	rows, err := db.Query(`SELECT token FROM fcm_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	if len(tokens) != 1 || tokens[0] != "good-token" {
+		t.Errorf("tokens = %v, want only good-token left", tokens)
+	}
+}
+
+func TestDeliverNotificationHonoursPushPreference(t *testing.T) {
+	db := openTestDB(t)
+	push := services.NewFakePushSender()
+	userID := createTestUser(t, db, "token")
+
+	_, err := db.Exec(`
+		INSERT INTO notification_preferences (user_id, type, push, email, in_app)
+		VALUES ($1, 'mention', false, false, true)`,
+		userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deliverNotification(db, push, notification{
+		UserID: userID, Type: "mention", Title: "Mentioned", Body: "Asha mentioned you",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := push.Sent(); len(sent) != 0 {
+		t.Errorf("sent %d pushes with push turned off", len(sent))
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, userID); n != 1 {
+		t.Errorf("inbox has %d notifications, want 1", n)
+	}
+}
+
+func TestSendPushDefersDuringQuietHours(t *testing.T) {
+	db := openTestDB(t)
+	push := services.NewFakePushSender()
+	userID := createTestUser(t, db, "token")
+
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		UPDATE users SET quiet_hours_start = $2, quiet_hours_end = $3 WHERE id = $1`,
+		userID, now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, notifType := range []string{"post_comment", "daily_reminder"} {
+		success, failure, err := sendPush(db, push, userID, notifType, "Title", "Body", nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if success != 0 || failure != 0 {
+			t.Errorf("%s: sent %d/%d during quiet hours", notifType, success, failure)
+		}
+	}
+
+	if sent := push.Sent(); len(sent) != 0 {
+		t.Errorf("sent %d pushes during quiet hours", len(sent))
+	}
+
+	// Comments wait for the morning; reminders are dropped.
+	var deferred []string
+	rows, err := db.Query(`SELECT type FROM deferred_pushes WHERE user_id = $1`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var notifType string
+		if err := rows.Scan(&notifType); err != nil {
+			t.Fatal(err)
+		}
+		deferred = append(deferred, notifType)
+	}
+	if len(deferred) != 1 || deferred[0] != "post_comment" {
+		t.Errorf("deferred = %v, want only post_comment", deferred)
+	}
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so helpers can run either
+// inside a handler's transaction or on their own.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const (
+	eventScoreAdd             = "score.add"
+	eventScoreSubtract        = "score.subtract"
+	eventNotifyNewPost        = "notify.new_post"
+	eventNotifyMentions       = "notify.mentions"
+	eventNotifyReaction       = "notify.reaction"
+	eventNotifyComment        = "notify.comment"
+	eventNotifyNewFollower    = "notify.new_follower"
+	eventNotifyFollowRequest  = "notify.follow_request"
+	eventNotifyFollowAccepted = "notify.follow_accepted"
+	eventNotifyEmail          = "notify.email"
+	eventCheckAchievements    = "achievements.check"
+	eventNotifyPact           = "notify.pact"
+)
+
+const (
+	outboxLockDuration        = 5 * time.Minute
+	outboxBaseBackoff         = 5 * time.Second
+	outboxMaxBackoff          = time.Hour
+	outboxDefaultPollInterval = time.Second
+	outboxDefaultConcurrency  = 4
+)
+
+type scoreEvent struct {
+	UserID    int        `json:"user_id"`
+	Action    ActionType `json:"action"`
+	PostID    *int       `json:"post_id,omitempty"`
+	CommentID *int       `json:"comment_id,omitempty"`
+	PostDate  *time.Time `json:"post_date,omitempty"`
+}
+
+type newPostEvent struct {
+	UserID int    `json:"user_id"`
+	PostID int    `json:"post_id"`
+	Text   string `json:"text"`
+}
+
+type mentionsEvent struct {
+	PostID           int    `json:"post_id"`
+	CommentID        *int   `json:"comment_id,omitempty"`
+	MentionerID      int    `json:"mentioner_id"`
+	MentionedUserIDs []int  `json:"mentioned_user_ids"`
+	Text             string `json:"text"`
+}
+
+type reactionEvent struct {
+	PostID       int    `json:"post_id"`
+	ReactorID    int    `json:"reactor_id"`
+	ReactionType string `json:"reaction_type"`
+}
+
+type commentEvent struct {
+	PostID      int    `json:"post_id"`
+	CommenterID int    `json:"commenter_id"`
+	Text        string `json:"text"`
+}
+
+type followEvent struct {
+	FollowerID  int `json:"follower_id"`
+	FollowingID int `json:"following_id"`
+}
+
+// enqueueEvent records a side effect to be carried out by the OutboxWorker.
+// Pass the transaction of the primary write so the event exists if and only
+// if that write commits. Enqueueing the same idempotencyKey twice is a no-op.
+func enqueueEvent(q queryer, eventType, idempotencyKey string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO outbox_events (event_type, idempotency_key, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (idempotency_key) DO NOTHING`,
+		eventType, eventType+":"+idempotencyKey, string(body))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// outboxDeps are the services outbox handlers can reach.
+type outboxDeps struct {
+	db   *sql.DB
+	push services.PushSender
+	mail *services.MailService
+}
+
+// outboxHandlers maps each event type to the code that carries it out. The
+// key passed in is the event's idempotency key; handlers that fan out use it
+// to skip recipients already handled by an earlier attempt.
+var outboxHandlers = map[string]func(d outboxDeps, key string, payload []byte) error{
+	eventScoreAdd: func(d outboxDeps, key string, payload []byte) error {
+		var e scoreEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		// Achievements follow score changes, so queue their check in the same
+		// transaction; a retry then never finds the score in without it.
+		return addReflectoScore(d.db, e.UserID, e.Action, e.PostDate, e.PostID, e.CommentID, key,
+			func(tx *sql.Tx) error {
+				return enqueueEvent(tx, eventCheckAchievements, key, achievementsEvent{UserID: e.UserID})
+			})
+	},
+	eventScoreSubtract: func(d outboxDeps, key string, payload []byte) error {
+		var e scoreEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return SubtractReflectoScore(d.db, e.UserID, e.Action, e.PostID, e.CommentID)
+	},
+	eventNotifyNewPost: func(d outboxDeps, key string, payload []byte) error {
+		var e newPostEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyFollowersOfNewPost(d.db, d.push, key, e.UserID, e.PostID, e.Text)
+	},
+	eventNotifyMentions: func(d outboxDeps, key string, payload []byte) error {
+		var e mentionsEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyMentionedUsers(d.db, d.push, key, e.PostID, e.CommentID, e.MentionerID, e.MentionedUserIDs, e.Text)
+	},
+	eventNotifyReaction: func(d outboxDeps, key string, payload []byte) error {
+		var e reactionEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyPostOwnerOfReaction(d.db, d.push, key, e.PostID, e.ReactorID, e.ReactionType)
+	},
+	eventNotifyComment: func(d outboxDeps, key string, payload []byte) error {
+		var e commentEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyPostOwnerOfComment(d.db, d.push, key, e.PostID, e.CommenterID, e.Text)
+	},
+	eventNotifyNewFollower: func(d outboxDeps, key string, payload []byte) error {
+		var e followEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyNewFollower(d.db, d.push, key, e.FollowerID, e.FollowingID)
+	},
+	eventNotifyFollowRequest: func(d outboxDeps, key string, payload []byte) error {
+		var e followEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyFollowRequest(d.db, d.push, key, e.FollowerID, e.FollowingID)
+	},
+	eventNotifyFollowAccepted: func(d outboxDeps, key string, payload []byte) error {
+		var e followEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyFollowAccepted(d.db, d.push, key, e.FollowingID, e.FollowerID)
+	},
+	eventNotifyEmail: func(d outboxDeps, key string, payload []byte) error {
+		var e emailEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return sendNotificationEmail(d.db, d.mail, key, e)
+	},
+	eventCheckAchievements: func(d outboxDeps, key string, payload []byte) error {
+		var e achievementsEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return checkAchievements(d.db, d.push, e.UserID)
+	},
+	eventNotifyPact: func(d outboxDeps, key string, payload []byte) error {
+		var e pactEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return notifyPact(d.db, d.push, key, e)
+	},
+}
+
+type outboxEvent struct {
+	ID             int64
+	EventType      string
+	IdempotencyKey string
+	Payload        []byte
+	Attempts       int
+	MaxAttempts    int
+}
+
+// OutboxWorker claims pending outbox events and runs them on a fixed pool of
+// goroutines, retrying failures with exponential backoff until an event runs
+// out of attempts and is marked dead.
+type OutboxWorker struct {
+	deps         outboxDeps
+	concurrency  int
+	pollInterval time.Duration
+
+	jobs   chan outboxEvent
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewOutboxWorker(db *sql.DB, push services.PushSender, mailSvc *services.MailService, concurrency int) *OutboxWorker {
+	if concurrency < 1 {
+		concurrency = outboxDefaultConcurrency
+	}
+	return &OutboxWorker{
+		deps:         outboxDeps{db: db, push: push, mail: mailSvc},
+		concurrency:  concurrency,
+		pollInterval: outboxDefaultPollInterval,
+		jobs:         make(chan outboxEvent),
+	}
+}
+
+func (w *OutboxWorker) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for event := range w.jobs {
+				w.process(event)
+			}
+		}()
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(w.jobs)
+		w.poll(ctx)
+	}()
+
+	log.Printf("[Outbox] Worker started with %d goroutines", w.concurrency)
+}
+
+// Stop stops claiming new events and waits for the ones already claimed to
+// finish.
+func (w *OutboxWorker) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+	log.Println("[Outbox] Worker stopped")
+}
+
+func (w *OutboxWorker) poll(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		events, err := w.claim(w.concurrency)
+		if err != nil {
+			log.Printf("[Outbox] Claim error: %v", err)
+		}
+
+		for _, event := range events {
+			w.jobs <- event
+		}
+
+		if len(events) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.pollInterval):
+			}
+		}
+	}
+}
+
+// claim locks up to limit due events. Events stuck in processing past their
+// lock (the process died mid-event) are picked up again.
+func (w *OutboxWorker) claim(limit int) ([]outboxEvent, error) {
+	rows, err := w.deps.db.Query(`
+		UPDATE outbox_events
+		SET status = 'processing',
+		    attempts = attempts + 1,
+		    locked_until = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			   OR (status = 'processing' AND locked_until < NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, idempotency_key, payload, attempts, max_attempts`,
+		limit, int(outboxLockDuration.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outboxEvent
+	for rows.Next() {
+		var e outboxEvent
+		if err := rows.Scan(&e.ID, &e.EventType, &e.IdempotencyKey, &e.Payload,
+			&e.Attempts, &e.MaxAttempts); err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (w *OutboxWorker) process(event outboxEvent) {
+	err := w.run(event)
+	if err == nil {
+		_, err = w.deps.db.Exec(`
+			UPDATE outbox_events
+			SET status = 'done', processed_at = NOW(), locked_until = NULL, last_error = NULL
+			WHERE id = $1`,
+			event.ID)
+		if err != nil {
+			log.Printf("[Outbox] Failed to mark event %d done: %v", event.ID, err)
+		}
+		return
+	}
+
+	if event.Attempts >= event.MaxAttempts {
+		log.Printf("[Outbox] Event %d (%s) is dead after %d attempts: %v",
+			event.ID, event.EventType, event.Attempts, err)
+		_, dbErr := w.deps.db.Exec(`
+			UPDATE outbox_events
+			SET status = 'dead', locked_until = NULL, last_error = $2
+			WHERE id = $1`,
+			event.ID, err.Error())
+		if dbErr != nil {
+			log.Printf("[Outbox] Failed to mark event %d dead: %v", event.ID, dbErr)
+		}
+		return
+	}
+
+	delay := outboxBackoff(event.Attempts)
+	log.Printf("[Outbox] Event %d (%s) attempt %d failed, retrying in %s: %v",
+		event.ID, event.EventType, event.Attempts, delay, err)
+	_, dbErr := w.deps.db.Exec(`
+		UPDATE outbox_events
+		SET status = 'pending',
+		    locked_until = NULL,
+		    last_error = $2,
+		    next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1`,
+		event.ID, err.Error(), delay.Milliseconds())
+	if dbErr != nil {
+		log.Printf("[Outbox] Failed to reschedule event %d: %v", event.ID, dbErr)
+	}
+}
+
+func (w *OutboxWorker) run(event outboxEvent) (err error) {
+	handler, ok := outboxHandlers[event.EventType]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", event.EventType)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handler(w.deps, event.IdempotencyKey, event.Payload)
+}
+
+// outboxBackoff returns the wait before the next attempt: 5s, 10s, 20s, ...
+// capped at an hour, with up to 20% jitter so failed bursts spread out.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
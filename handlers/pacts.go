@@ -0,0 +1,767 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+const (
+	pactInvite   = "pact_invite"
+	pactAccepted = "pact_accepted"
+	pactNudge    = "pact_nudge"
+)
+
+// pactNudgeInterval is how long a partner must wait between nudges.
+const pactNudgeInterval = 12 * time.Hour
+
+// pactHistoryDays caps how many days GetPact returns.
+const pactHistoryDays = 30
+
+type pactPartner struct {
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+type Pact struct {
+	ID        int         `json:"id"`
+	Status    string      `json:"status"`
+	InviterID int         `json:"inviter_id"`
+	InviteeID int         `json:"invitee_id"`
+	Partner   pactPartner `json:"partner"`
+	// CurrentStreak is 0 once a shared day has been missed.
+	CurrentStreak  int        `json:"current_streak"`
+	LongestStreak  int        `json:"longest_streak"`
+	LastSharedDate *string    `json:"last_shared_date,omitempty"`
+	StartedOn      *string    `json:"started_on,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+
+	today          time.Time
+	startedOn      time.Time
+	lastSharedDate time.Time
+}
+
+type pactDay struct {
+	Date          string `json:"date"`
+	YouPosted     bool   `json:"you_posted"`
+	PartnerPosted bool   `json:"partner_posted"`
+}
+
+type pactEvent struct {
+	PactID      int    `json:"pact_id"`
+	Kind        string `json:"kind"`
+	ActorID     int    `json:"actor_id"`
+	RecipientID int    `json:"recipient_id"`
+}
+
+// pactSelectSQL reads pacts from the point of view of the user bound to $1,
+// with the partner and both timezones alongside.
+const pactSelectSQL = `
+	SELECT p.id, p.status, p.inviter_id, p.invitee_id, p.streak_count, p.longest_streak,
+	       p.last_shared_date, p.started_on, p.created_at, p.accepted_at, p.ended_at,
+	       partner.id, partner.username, partner.display_name,
+	       COALESCE(me.timezone, 'UTC'), COALESCE(partner.timezone, 'UTC')
+	FROM pacts p
+	JOIN users me ON me.id = $1
+	JOIN users partner ON partner.id = CASE WHEN p.inviter_id = $1 THEN p.invitee_id ELSE p.inviter_id END
+	WHERE (p.inviter_id = $1 OR p.invitee_id = $1)`
+
+func scanPact(row interface{ Scan(...interface{}) error }) (Pact, error) {
+	var p Pact
+	var streakCount int
+	var lastShared, startedOn, acceptedAt, endedAt sql.NullTime
+	var myTimezone, partnerTimezone string
+	err := row.Scan(&p.ID, &p.Status, &p.InviterID, &p.InviteeID, &streakCount, &p.LongestStreak,
+		&lastShared, &startedOn, &p.CreatedAt, &acceptedAt, &endedAt,
+		&p.Partner.UserID, &p.Partner.Username, &p.Partner.DisplayName,
+		&myTimezone, &partnerTimezone)
+	if err != nil {
+		return p, err
+	}
+
+	if lastShared.Valid {
+		p.lastSharedDate = lastShared.Time.UTC()
+		s := p.lastSharedDate.Format("2006-01-02")
+		p.LastSharedDate = &s
+	}
+	if startedOn.Valid {
+		p.startedOn = startedOn.Time.UTC()
+		s := p.startedOn.Format("2006-01-02")
+		p.StartedOn = &s
+	}
+	if acceptedAt.Valid {
+		p.AcceptedAt = &acceptedAt.Time
+	}
+	if endedAt.Valid {
+		p.EndedAt = &endedAt.Time
+	}
+
+	p.today = pactToday(time.Now().UTC(), myTimezone, partnerTimezone)
+	// The streak survives until a day both partners have finished goes by
+	// without a shared post.
+	if p.Status == "active" && !p.lastSharedDate.IsZero() && daysBetween(p.lastSharedDate, p.today) <= 1 {
+		p.CurrentStreak = streakCount
+	}
+	return p, nil
+}
+
+// pactToday is the journal day still open for both partners: the earlier of
+// their two journal dates.
+func pactToday(nowUTC time.Time, timezoneA, timezoneB string) time.Time {
+	a, err := ComputeJournalDate(nowUTC, timezoneA)
+	if err != nil {
+		a, _ = ComputeJournalDate(nowUTC, "UTC")
+	}
+	b, err := ComputeJournalDate(nowUTC, timezoneB)
+	if err != nil {
+		b, _ = ComputeJournalDate(nowUTC, "UTC")
+	}
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func loadPact(q queryer, viewerID, pactID int) (Pact, error) {
+	return scanPact(q.QueryRow(pactSelectSQL+` AND p.id = $2`, viewerID, pactID))
+}
+
+// areMutualFollowers reports whether both users follow each other.
+func areMutualFollowers(q queryer, userA, userB int) (bool, error) {
+	var count int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM followers
+		WHERE status = 'accepted'
+		  AND ((follower_id = $1 AND following_id = $2) OR (follower_id = $2 AND following_id = $1))`,
+		userA, userB).Scan(&count)
+	return count == 2, err
+}
+
+// rebuildPactStreaks recomputes the shared streak of every active pact the
+// user is in. CreatePost and DeletePost call it in their transaction.
+func rebuildPactStreaks(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`
+		SELECT id, inviter_id, invitee_id, started_on
+		FROM pacts
+		WHERE status = 'active' AND (inviter_id = $1 OR invitee_id = $1)
+		ORDER BY id
+		FOR UPDATE`,
+		userID)
+	if err != nil {
+		return err
+	}
+
+	type activePact struct {
+		id, userA, userB int
+		startedOn        time.Time
+	}
+	var active []activePact
+	for rows.Next() {
+		var p activePact
+		if err := rows.Scan(&p.id, &p.userA, &p.userB, &p.startedOn); err != nil {
+			rows.Close()
+			return err
+		}
+		active = append(active, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range active {
+		if err := rebuildPactStreak(tx, p.id, p.userA, p.userB, p.startedOn); err != nil {
+			return fmt.Errorf("pact %d: %w", p.id, err)
+		}
+	}
+	return nil
+}
+
+// rebuildPactStreak counts the runs of consecutive journal dates, from
+// startedOn, on which both partners posted. Each post's journal date was
+// already worked out in its author's timezone.
+func rebuildPactStreak(tx *sql.Tx, pactID, userA, userB int, startedOn time.Time) error {
+	rows, err := tx.Query(`
+		SELECT a.journal_date
+		FROM posts a
+		JOIN posts b ON b.user_id = $2 AND b.journal_date = a.journal_date
+		WHERE a.user_id = $1 AND a.journal_date >= $3
+		ORDER BY a.journal_date`,
+		userA, userB, startedOn)
+	if err != nil {
+		return err
+	}
+
+	var count, longest int
+	var last time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			rows.Close()
+			return err
+		}
+		d = d.UTC()
+		if !last.IsZero() && daysBetween(last, d) == 1 {
+			count++
+		} else {
+			count = 1
+		}
+		if count > longest {
+			longest = count
+		}
+		last = d
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var lastShared interface{}
+	if !last.IsZero() {
+		lastShared = last
+	}
+	_, err = tx.Exec(`
+		UPDATE pacts
+		SET streak_count = $2, longest_streak = $3, last_shared_date = $4
+		WHERE id = $1`,
+		pactID, count, longest, lastShared)
+	return err
+}
+
+// GetPacts lists the authenticated user's pacts, newest first, including
+// past ones. ?status= narrows it to one status.
+func GetPacts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		rows, err := db.Query(pactSelectSQL+`
+			AND ($2 = '' OR p.status = $2)
+			ORDER BY p.created_at DESC`,
+			userID, status)
+		if err != nil {
+			http.Error(w, "Failed to fetch pacts", http.StatusInternalServerError)
+			log.Println("GetPacts query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		pacts := []Pact{}
+		for rows.Next() {
+			p, err := scanPact(rows)
+			if err != nil {
+				http.Error(w, "Failed to fetch pacts", http.StatusInternalServerError)
+				log.Println("GetPacts scan error:", err)
+				return
+			}
+			pacts = append(pacts, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pacts)
+	}
+}
+
+// GetPact returns one pact with which partner posted on each of its last
+// pactHistoryDays days.
+func GetPact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pactID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid pact ID", http.StatusBadRequest)
+			return
+		}
+
+		p, err := loadPact(db, userID, pactID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pact not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch pact", http.StatusInternalServerError)
+			log.Println("GetPact error:", err)
+			return
+		}
+
+		// Partners who have blocked each other no longer see each other's days.
+		blocked, err := isBlockedEitherWay(db, userID, p.Partner.UserID)
+		if err != nil {
+			http.Error(w, "Failed to fetch pact", http.StatusInternalServerError)
+			log.Println("GetPact block check error:", err)
+			return
+		}
+
+		days := []pactDay{}
+		if !p.startedOn.IsZero() && !blocked {
+			to := p.today
+			if p.EndedAt != nil {
+				ended := p.EndedAt.UTC()
+				to = time.Date(ended.Year(), ended.Month(), ended.Day(), 0, 0, 0, 0, time.UTC)
+			}
+			from := to.AddDate(0, 0, -(pactHistoryDays - 1))
+			if from.Before(p.startedOn) {
+				from = p.startedOn
+			}
+
+			rows, err := db.Query(`
+				SELECT to_char(d, 'YYYY-MM-DD'),
+				       EXISTS (SELECT 1 FROM posts WHERE user_id = $1 AND journal_date = d::date),
+				       EXISTS (SELECT 1 FROM posts WHERE user_id = $2 AND journal_date = d::date)
+				FROM generate_series($3::date, $4::date, INTERVAL '1 day') AS d
+				ORDER BY d`,
+				userID, p.Partner.UserID, from, to)
+			if err != nil {
+				http.Error(w, "Failed to fetch pact", http.StatusInternalServerError)
+				log.Println("GetPact days error:", err)
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var d pactDay
+				if err := rows.Scan(&d.Date, &d.YouPosted, &d.PartnerPosted); err != nil {
+					http.Error(w, "Failed to fetch pact", http.StatusInternalServerError)
+					log.Println("GetPact days scan error:", err)
+					return
+				}
+				days = append(days, d)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pact": p,
+			"days": days,
+		})
+	}
+}
+
+// CreatePact invites a mutual follower into a pact.
+func CreatePact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			PartnerID int `json:"partner_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PartnerID == 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.PartnerID == userID {
+			http.Error(w, "You cannot make a pact with yourself", http.StatusBadRequest)
+			return
+		}
+
+		blocked, err := isBlockedEitherWay(db, userID, req.PartnerID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("CreatePact block check error:", err)
+			return
+		}
+		mutual, err := areMutualFollowers(db, userID, req.PartnerID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("CreatePact follow check error:", err)
+			return
+		}
+		if blocked || !mutual {
+			http.Error(w, "Pacts are only possible between mutual followers", http.StatusForbidden)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var pactID int
+		err = tx.QueryRow(`
+			INSERT INTO pacts (inviter_id, invitee_id)
+			VALUES ($1, $2)
+			RETURNING id`,
+			userID, req.PartnerID).Scan(&pactID)
+		if err != nil {
+			if strings.Contains(err.Error(), "uniq_open_pact") {
+				http.Error(w, "You already have a pact with this user", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to create pact", http.StatusInternalServerError)
+			log.Println("CreatePact insert error:", err)
+			return
+		}
+
+		err = enqueueEvent(tx, eventNotifyPact, fmt.Sprintf("pact:%d:invite", pactID), pactEvent{
+			PactID: pactID, Kind: pactInvite, ActorID: userID, RecipientID: req.PartnerID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to create pact", http.StatusInternalServerError)
+			log.Println("CreatePact outbox error:", err)
+			return
+		}
+
+		p, err := loadPact(tx, userID, pactID)
+		if err != nil {
+			http.Error(w, "Failed to create pact", http.StatusInternalServerError)
+			log.Println("CreatePact reload error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// AcceptPact starts a pending pact the authenticated user was invited to.
+// The shared streak counts from the journal day still open for both.
+func AcceptPact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pactID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid pact ID", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		p, err := loadPact(tx, userID, pactID)
+		if err == sql.ErrNoRows || (err == nil && (p.Status != "pending" || p.InviteeID != userID)) {
+			http.Error(w, "Pact invite not found or already processed", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact load error:", err)
+			return
+		}
+
+		mutual, err := areMutualFollowers(tx, p.InviterID, p.InviteeID)
+		if err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact follow check error:", err)
+			return
+		}
+		if !mutual {
+			http.Error(w, "Pacts are only possible between mutual followers", http.StatusForbidden)
+			return
+		}
+
+		result, err := tx.Exec(`
+			UPDATE pacts
+			SET status = 'active', accepted_at = NOW(), started_on = $2
+			WHERE id = $1 AND status = 'pending'`,
+			pactID, p.today)
+		if err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact update error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Pact invite not found or already processed", http.StatusNotFound)
+			return
+		}
+
+		if err := rebuildPactStreak(tx, pactID, p.InviterID, p.InviteeID, p.today); err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact streak error:", err)
+			return
+		}
+
+		err = enqueueEvent(tx, eventNotifyPact, fmt.Sprintf("pact:%d:accepted", pactID), pactEvent{
+			PactID: pactID, Kind: pactAccepted, ActorID: userID, RecipientID: p.InviterID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact outbox error:", err)
+			return
+		}
+
+		if p, err = loadPact(tx, userID, pactID); err != nil {
+			http.Error(w, "Failed to accept pact", http.StatusInternalServerError)
+			log.Println("AcceptPact reload error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+func DeclinePact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pactID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid pact ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE pacts
+			SET status = 'declined', ended_at = NOW(), ended_by = $2
+			WHERE id = $1 AND invitee_id = $2 AND status = 'pending'`,
+			pactID, userID)
+		if err != nil {
+			http.Error(w, "Failed to decline pact", http.StatusInternalServerError)
+			log.Println("DeclinePact error:", err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "Pact invite not found or already processed", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Pact declined",
+		})
+	}
+}
+
+// EndPact lets the inviter withdraw a pending invite, or either partner end
+// an active pact. Ended pacts stay in the history.
+func EndPact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pactID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid pact ID", http.StatusBadRequest)
+			return
+		}
+
+		var status string
+		err = db.QueryRow(`
+			UPDATE pacts
+			SET status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE 'ended' END,
+			    ended_at = NOW(),
+			    ended_by = $2
+			WHERE id = $1
+			  AND ((status = 'pending' AND inviter_id = $2)
+			    OR (status = 'active' AND (inviter_id = $2 OR invitee_id = $2)))
+			RETURNING status`,
+			pactID, userID).Scan(&status)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pact not found or already ended", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to end pact", http.StatusInternalServerError)
+			log.Println("EndPact error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Pact " + status,
+			"status":  status,
+		})
+	}
+}
+
+// NudgePact pushes a reminder to a partner who hasn't posted for their
+// journal day yet, at most once per pactNudgeInterval from each partner.
+func NudgePact(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pactID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid pact ID", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Serialises nudges on the pact so the interval check holds.
+		if _, err := tx.Exec(`SELECT 1 FROM pacts WHERE id = $1 FOR UPDATE`, pactID); err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact lock error:", err)
+			return
+		}
+
+		p, err := loadPact(tx, userID, pactID)
+		if err == sql.ErrNoRows || (err == nil && p.Status != "active") {
+			http.Error(w, "Active pact not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact load error:", err)
+			return
+		}
+
+		blocked, err := isBlockedEitherWay(tx, userID, p.Partner.UserID)
+		if err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact block check error:", err)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot nudge this user", http.StatusForbidden)
+			return
+		}
+
+		var partnerTimezone string
+		err = tx.QueryRow(`SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = $1`, p.Partner.UserID).Scan(&partnerTimezone)
+		if err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact timezone error:", err)
+			return
+		}
+		partnerToday, err := ComputeJournalDate(time.Now().UTC(), partnerTimezone)
+		if err != nil {
+			partnerToday, _ = ComputeJournalDate(time.Now().UTC(), "UTC")
+		}
+
+		var posted, recentlyNudged bool
+		err = tx.QueryRow(`
+			SELECT
+				EXISTS (SELECT 1 FROM posts WHERE user_id = $1 AND journal_date = $2),
+				EXISTS (SELECT 1 FROM pact_nudges
+				        WHERE pact_id = $3 AND sender_id = $4 AND created_at > $5)`,
+			p.Partner.UserID, partnerToday, pactID, userID, time.Now().Add(-pactNudgeInterval)).
+			Scan(&posted, &recentlyNudged)
+		if err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact check error:", err)
+			return
+		}
+		if posted {
+			http.Error(w, "Your partner already posted today", http.StatusConflict)
+			return
+		}
+		if recentlyNudged {
+			http.Error(w, "You already nudged your partner recently", http.StatusTooManyRequests)
+			return
+		}
+
+		var nudgeID int
+		err = tx.QueryRow(`
+			INSERT INTO pact_nudges (pact_id, sender_id)
+			VALUES ($1, $2)
+			RETURNING id`,
+			pactID, userID).Scan(&nudgeID)
+		if err == nil {
+			err = enqueueEvent(tx, eventNotifyPact, "pact_nudge:"+strconv.Itoa(nudgeID), pactEvent{
+				PactID: pactID, Kind: pactNudge, ActorID: userID, RecipientID: p.Partner.UserID,
+			})
+		}
+		if err != nil {
+			http.Error(w, "Failed to nudge partner", http.StatusInternalServerError)
+			log.Println("NudgePact insert error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Nudge sent",
+		})
+	}
+}
+
+func notifyPact(db *sql.DB, push services.PushSender, eventKey string, e pactEvent) error {
+	if blocked, err := isBlockedEitherWay(db, e.ActorID, e.RecipientID); err != nil || blocked {
+		return err
+	}
+
+	actorName := fetchDisplayName(db, e.ActorID, "Your partner")
+
+	var title, body string
+	switch e.Kind {
+	case pactInvite:
+		title = "Accountability pact invite"
+		body = actorName + " wants to keep a journaling streak with you"
+	case pactAccepted:
+		title = "Pact accepted"
+		body = actorName + " accepted your pact. Post every day to grow your shared streak!"
+	case pactNudge:
+		title = actorName + " nudged you"
+		body = "Write today's entry to keep your shared streak alive"
+	default:
+		return fmt.Errorf("unknown pact event kind %q", e.Kind)
+	}
+
+	return deliverNotification(db, push, notification{
+		UserID:     e.RecipientID,
+		ActorID:    e.ActorID,
+		Type:       e.Kind,
+		TargetType: "pact",
+		TargetID:   e.PactID,
+		Title:      title,
+		Body:       body,
+		Data: map[string]string{
+			"type":    e.Kind,
+			"pact_id": strconv.Itoa(e.PactID),
+			"user_id": strconv.Itoa(e.ActorID),
+		},
+		DedupeKey: eventKey,
+	})
+}
@@ -126,16 +126,9 @@ func GetUserFeed(db *sql.DB) http.HandlerFunc {
 				(SELECT reaction_type FROM reactions WHERE post_id = p.id AND user_id = $1) AS user_reaction
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
-			WHERE (
-				p.user_id = $1
-				OR p.user_id IN (
-					SELECT following_id FROM followers 
-					WHERE follower_id = $1 AND status = 'accepted'
-					UNION
-					SELECT follower_id FROM followers 
-					WHERE following_id = $1 AND status = 'accepted'
-				)
-			)
+			WHERE p.user_id IN `+visibleAuthorsSQL("$1")+`
+			AND p.user_id NOT IN `+blockedUsersSQL("$1")+`
+			AND p.user_id NOT IN (SELECT muted_id FROM user_mutes WHERE muter_id = $1)
 			AND p.journal_date >= $2
 			ORDER BY p.journal_date DESC, p.created_at DESC
 		`, userID, startJournalDate)
@@ -268,7 +261,14 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		err = db.QueryRow(`
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow(`
 			INSERT INTO posts (
 				user_id,
 				template_id,
@@ -298,9 +298,56 @@ func CreatePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		go AddReflectoScore(db, p.UserID, ActionPost, &journalDate, nil)
+		if err := syncPostTags(tx, p.ID, p.UserID, journalDate, p.Text); err != nil {
+			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			log.Println("CreatePost tags error:", err)
+			return
+		}
 
-		go notifyFollowersOfNewPost(db, p.UserID, p.Text)
+		mentioned, err := saveMentions(tx, p.ID, nil, p.UserID, p.Text)
+		if err != nil {
+			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			log.Println("CreatePost mentions error:", err)
+			return
+		}
+
+		postKey := "post:" + strconv.Itoa(p.ID)
+		err = enqueueEvent(tx, eventScoreAdd, postKey, scoreEvent{
+			UserID: p.UserID, Action: ActionPost, PostID: &p.ID, PostDate: &journalDate,
+		})
+		if err == nil {
+			err = enqueueEvent(tx, eventNotifyNewPost, postKey, newPostEvent{
+				UserID: p.UserID, PostID: p.ID, Text: p.Text,
+			})
+		}
+		if err == nil && len(mentioned) > 0 {
+			err = enqueueEvent(tx, eventNotifyMentions, postKey, mentionsEvent{
+				PostID: p.ID, MentionerID: p.UserID, MentionedUserIDs: mentioned, Text: p.Text,
+			})
+		}
+		if err != nil {
+			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			log.Println("CreatePost outbox error:", err)
+			return
+		}
+
+		_, err = rebuildStreak(tx, p.UserID)
+		if err == nil {
+			err = rebuildPactStreaks(tx, p.UserID)
+		}
+		if err == nil {
+			err = completeChallenges(tx, p.UserID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			log.Println("CreatePost streak error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -352,8 +399,15 @@ func UpdatePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
 		var updatedPost models.Post
-		err = db.QueryRow(`
+		err = tx.QueryRow(`
 			UPDATE posts
 			SET text = $1, updated_at = NOW()
 			WHERE id = $2
@@ -374,6 +428,36 @@ func UpdatePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := syncPostTags(tx, postID, updatedPost.UserID, updatedPost.JournalDate, req.Text); err != nil {
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			log.Println("UpdatePost tags error:", err)
+			return
+		}
+
+		mentioned, err := saveMentions(tx, postID, nil, req.UserID, req.Text)
+		if err != nil {
+			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			log.Println("UpdatePost mentions error:", err)
+			return
+		}
+		if len(mentioned) > 0 {
+			// Each edit can mention new people, so the edit time keeps the key unique.
+			editKey := fmt.Sprintf("post:%d:edit:%d", postID, time.Now().UnixNano())
+			err = enqueueEvent(tx, eventNotifyMentions, editKey, mentionsEvent{
+				PostID: postID, MentionerID: req.UserID, MentionedUserIDs: mentioned, Text: req.Text,
+			})
+			if err != nil {
+				http.Error(w, "Failed to update post", http.StatusInternalServerError)
+				log.Println("UpdatePost outbox error:", err)
+				return
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(updatedPost)
 	}
@@ -402,63 +486,65 @@ func ComputeJournalDate(nowUTC time.Time, timezone string) (time.Time, error) {
 	return journalDate, nil
 }
 
-func notifyFollowersOfNewPost(db *sql.DB, userID int, postText string) {
-	var displayName string
-	err := db.QueryRow(`SELECT display_name FROM users WHERE id = $1`, userID).Scan(&displayName)
-	if err != nil {
-		log.Printf("Error fetching user display name for notifications: %v", err)
-		displayName = "A friend"
-	}
+func notifyFollowersOfNewPost(db *sql.DB, push services.PushSender, eventKey string, userID int, postID int, postText string) error {
+	displayName := fetchDisplayName(db, userID, "A friend")
 
 	rows, err := db.Query(`
-		SELECT DISTINCT ft.token
+		SELECT f.follower_id
 		FROM followers f
-		JOIN fcm_tokens ft ON f.follower_id = ft.user_id
-		WHERE f.following_id = $1 
+		WHERE f.following_id = $1
 		  AND f.status = 'accepted'
-		  AND ft.token IS NOT NULL 
-		  AND ft.token != ''`,
+		  AND f.follower_id NOT IN (SELECT muter_id FROM user_mutes WHERE muted_id = $1)`,
 		userID)
 	if err != nil {
-		log.Printf("Error fetching follower FCM tokens: %v", err)
-		return
+		return fmt.Errorf("failed to fetch followers: %w", err)
 	}
-	defer rows.Close()
 
-	var tokens []string
+	var followerIDs []int
 	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			log.Printf("Error scanning FCM token: %v", err)
+		var followerID int
+		if err := rows.Scan(&followerID); err != nil {
+			log.Printf("Error scanning follower ID: %v", err)
 			continue
 		}
-		tokens = append(tokens, token)
-	}
-
-	if len(tokens) == 0 {
-		log.Printf("No FCM tokens found for user %d's followers", userID)
-		return
-	}
-
-	title := fmt.Sprintf("%s posted today!", displayName)
-	body := postText
-	if len(body) > 100 {
-		body = body[:97] + "..."
+		followerIDs = append(followerIDs, followerID)
 	}
+	rows.Close()
 
-	data := map[string]string{
-		"type":    "new_post",
-		"user_id": strconv.Itoa(userID),
+	if len(followerIDs) == 0 {
+		log.Printf("No followers to notify for user %d's post", userID)
+		return nil
 	}
 
-	successCount, failureCount, err := services.SendMultipleNotifications(db, tokens, title, body, data)
-	if err != nil {
-		log.Printf("Error sending notifications to followers: %v", err)
-		return
+	// Keep going past failures; the retry skips followers already notified.
+	var lastErr error
+	for _, followerID := range followerIDs {
+		err := deliverNotification(db, push, notification{
+			UserID:     followerID,
+			ActorID:    userID,
+			Type:       "new_post",
+			TargetType: "post",
+			TargetID:   postID,
+			Title:      fmt.Sprintf("%s posted today!", displayName),
+			Body:       truncateForPush(postText),
+			Data: map[string]string{
+				"type":    "new_post",
+				"user_id": strconv.Itoa(userID),
+				"post_id": strconv.Itoa(postID),
+			},
+			GroupKey: "new_post",
+			GroupTitle: func(others int) string {
+				return andOthers(displayName, others) + " posted today!"
+			},
+			DedupeKey: eventKey,
+		})
+		if err != nil {
+			lastErr = err
+		}
 	}
 
-	log.Printf("Sent notifications for new post by user %d: %d successful, %d failed",
-		userID, successCount, failureCount)
+	log.Printf("Notified %d followers of new post by user %d", len(followerIDs), userID)
+	return lastErr
 }
 
 func DeletePost(db *sql.DB) http.HandlerFunc {
@@ -478,14 +564,45 @@ func DeletePost(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(`DELETE FROM posts WHERE id = $1`, id)
+		postID, _ := strconv.Atoi(id)
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`DELETE FROM posts WHERE id = $1`, id)
 		if err != nil {
 			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			log.Println(err)
 			return
 		}
 
-		go SubtractReflectoScore(db, ownerID, ActionPost, nil)
+		err = enqueueEvent(tx, eventScoreSubtract, "post:"+id, scoreEvent{
+			UserID: ownerID, Action: ActionPost, PostID: &postID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			log.Println("DeletePost outbox error:", err)
+			return
+		}
+
+		_, err = rebuildStreak(tx, ownerID)
+		if err == nil {
+			err = rebuildPactStreaks(tx, ownerID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			log.Println("DeletePost streak error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -594,6 +711,27 @@ func AddReaction(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		var postOwnerID int
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = $1`, postID).Scan(&postOwnerID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		blocked, err := isBlockedEitherWay(db, req.UserID, postOwnerID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("AddReaction block check error:", err)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot react to this post", http.StatusForbidden)
+			return
+		}
+
 		var existingReactionID int
 		var existingReactionType string
 
@@ -609,7 +747,14 @@ func AddReaction(db *sql.DB) http.HandlerFunc {
 
 			var reactionID int
 
-			err = db.QueryRow(`
+			tx, err := db.Begin()
+			if err != nil {
+				http.Error(w, "Transaction error", http.StatusInternalServerError)
+				return
+			}
+			defer tx.Rollback()
+
+			err = tx.QueryRow(`
                 INSERT INTO reactions (user_id, post_id, reaction_type)
                 VALUES ($1, $2, $3)
                 RETURNING id`,
@@ -624,13 +769,29 @@ func AddReaction(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			go notifyPostOwnerOfReaction(
-				db,
-				postID,
-				req.UserID,
-				req.ReactionType,
-			)
-			go AddReflectoScore(db, req.UserID, ActionReaction, nil, &postID)
+			reactionKey := "reaction:" + strconv.Itoa(reactionID)
+			err = enqueueEvent(tx, eventNotifyReaction, reactionKey, reactionEvent{
+				PostID: postID, ReactorID: req.UserID, ReactionType: req.ReactionType,
+			})
+			if err == nil {
+				err = enqueueEvent(tx, eventScoreAdd, reactionKey, scoreEvent{
+					UserID: req.UserID, Action: ActionReaction, PostID: &postID,
+				})
+			}
+			if err == nil && postOwnerID != req.UserID {
+				// Reactions received count towards the post owner's achievements.
+				err = enqueueEvent(tx, eventCheckAchievements, reactionKey, achievementsEvent{UserID: postOwnerID})
+			}
+			if err != nil {
+				http.Error(w, "Failed to create reaction", http.StatusInternalServerError)
+				log.Println("AddReaction outbox error:", err)
+				return
+			}
+
+			if err = tx.Commit(); err != nil {
+				http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+				return
+			}
 
 			w.Header().Set("Content-Type", "application/json")
 
@@ -650,7 +811,14 @@ func AddReaction(db *sql.DB) http.HandlerFunc {
 
 		if existingReactionType == req.ReactionType {
 
-			_, err = db.Exec(`
+			tx, err := db.Begin()
+			if err != nil {
+				http.Error(w, "Transaction error", http.StatusInternalServerError)
+				return
+			}
+			defer tx.Rollback()
+
+			_, err = tx.Exec(`
                 DELETE FROM reactions
                 WHERE id = $1`,
 				existingReactionID,
@@ -662,7 +830,19 @@ func AddReaction(db *sql.DB) http.HandlerFunc {
 				return
 			}
 
-			go SubtractReflectoScore(db, req.UserID, ActionReaction, &postID)
+			err = enqueueEvent(tx, eventScoreSubtract, "reaction:"+strconv.Itoa(existingReactionID), scoreEvent{
+				UserID: req.UserID, Action: ActionReaction, PostID: &postID,
+			})
+			if err != nil {
+				http.Error(w, "Failed to remove reaction", http.StatusInternalServerError)
+				log.Println("AddReaction outbox error:", err)
+				return
+			}
+
+			if err = tx.Commit(); err != nil {
+				http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+				return
+			}
 
 			w.Header().Set("Content-Type", "application/json")
 
@@ -781,7 +961,35 @@ func CreateComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		err = db.QueryRow(`
+		var postOwnerID int
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = $1`, postIDInt).Scan(&postOwnerID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		blocked, err := isBlockedEitherWay(db, comment.UserID, postOwnerID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("CreateComment block check error:", err)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot comment on this post", http.StatusForbidden)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow(`
             INSERT INTO comments (post_id, user_id, text)
             VALUES ($1, $2, $3)
             RETURNING id, post_id, user_id, text, created_at`,
@@ -795,8 +1003,38 @@ func CreateComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		go notifyPostOwnerOfComment(db, postIDInt, comment.UserID, comment.Text)
-		go AddReflectoScore(db, comment.UserID, ActionComment, nil, &postIDInt)
+		mentioned, err := saveMentions(tx, postIDInt, &comment.ID, comment.UserID, comment.Text)
+		if err != nil {
+			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+			log.Println("CreateComment mentions error:", err)
+			return
+		}
+
+		commentKey := "comment:" + strconv.Itoa(comment.ID)
+		err = enqueueEvent(tx, eventNotifyComment, commentKey, commentEvent{
+			PostID: postIDInt, CommenterID: comment.UserID, Text: comment.Text,
+		})
+		if err == nil && len(mentioned) > 0 {
+			err = enqueueEvent(tx, eventNotifyMentions, commentKey, mentionsEvent{
+				PostID: postIDInt, CommentID: &comment.ID, MentionerID: comment.UserID,
+				MentionedUserIDs: mentioned, Text: comment.Text,
+			})
+		}
+		if err == nil {
+			err = enqueueEvent(tx, eventScoreAdd, commentKey, scoreEvent{
+				UserID: comment.UserID, Action: ActionComment, PostID: &postIDInt, CommentID: &comment.ID,
+			})
+		}
+		if err != nil {
+			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+			log.Println("CreateComment outbox error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -820,6 +1058,7 @@ func GetPostComments(db *sql.DB) http.HandlerFunc {
             FROM comments c
             JOIN users u ON c.user_id = u.id
             WHERE c.post_id = $1
+              AND c.user_id NOT IN `+blockedUsersSQL("$2")+`
             ORDER BY c.created_at ASC`,
 			postID, currentUserID)
 
@@ -880,9 +1119,9 @@ func DeleteComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var ownerID, postIDInt int
-		err := db.QueryRow(`SELECT user_id, post_id FROM comments WHERE id = $1`,
-			commentID).Scan(&ownerID, &postIDInt)
+		var ownerID, postIDInt, commentIDInt int
+		err := db.QueryRow(`SELECT id, user_id, post_id FROM comments WHERE id = $1`,
+			commentID).Scan(&commentIDInt, &ownerID, &postIDInt)
 
 		if err == sql.ErrNoRows {
 			http.Error(w, "Comment not found", http.StatusNotFound)
@@ -897,14 +1136,33 @@ func DeleteComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(`DELETE FROM comments WHERE id = $1`, commentID)
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`DELETE FROM comments WHERE id = $1`, commentID)
 		if err != nil {
 			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
 			log.Println("DeleteComment error:", err)
 			return
 		}
 
-		go SubtractReflectoScore(db, ownerID, ActionComment, &postIDInt)
+		err = enqueueEvent(tx, eventScoreSubtract, "comment:"+commentID, scoreEvent{
+			UserID: ownerID, Action: ActionComment, PostID: &postIDInt, CommentID: &commentIDInt,
+		})
+		if err != nil {
+			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+			log.Println("DeleteComment outbox error:", err)
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -915,14 +1173,15 @@ func DeleteComment(db *sql.DB) http.HandlerFunc {
 
 func notifyPostOwnerOfReaction(
 	db *sql.DB,
+	push services.PushSender,
+	eventKey string,
 	postID int,
 	reactorUserID int,
 	reactionType string,
-) {
+) error {
 
 	var postOwnerID int
 	var postText string
-	var reactorDisplayName string
 
 	err := db.QueryRow(`
 		SELECT user_id, text
@@ -931,195 +1190,99 @@ func notifyPostOwnerOfReaction(
 		postID,
 	).Scan(&postOwnerID, &postText)
 
+	if err == sql.ErrNoRows {
+		// The post was deleted before we got to it.
+		return nil
+	}
 	if err != nil {
-		log.Printf(
-			"Error fetching post info for reaction notification: %v",
-			err,
-		)
-		return
+		return fmt.Errorf("failed to fetch post for reaction notification: %w", err)
 	}
 
 	if postOwnerID == reactorUserID {
-		return
+		return nil
 	}
 
-	err = db.QueryRow(`
-		SELECT display_name
-		FROM users
-		WHERE id = $1`,
-		reactorUserID,
-	).Scan(&reactorDisplayName)
-
-	if err != nil {
-		log.Printf(
-			"Error fetching reactor display name: %v",
-			err,
-		)
-		reactorDisplayName = "Someone"
-	}
-
-	rows, err := db.Query(`
-		SELECT token
-		FROM fcm_tokens
-		WHERE user_id = $1
-		  AND token IS NOT NULL
-		  AND token != ''`,
-		postOwnerID,
-	)
-
-	if err != nil {
-		log.Printf(
-			"Error fetching post owner FCM tokens: %v",
-			err,
-		)
-		return
+	if blocked, err := isBlockedEitherWay(db, reactorUserID, postOwnerID); err != nil || blocked {
+		return err
 	}
 
-	defer rows.Close()
-
-	var tokens []string
-
-	for rows.Next() {
-		var token string
-
-		if err := rows.Scan(&token); err != nil {
-			log.Printf("Error scanning FCM token: %v", err)
-			continue
-		}
-
-		tokens = append(tokens, token)
-	}
-
-	if len(tokens) == 0 {
-		return
-	}
+	reactorDisplayName := fetchDisplayName(db, reactorUserID, "Someone")
 
 	emoji := constants.ReactionEmojis[reactionType]
 
-	title := fmt.Sprintf(
-		"%s reacted %s to your post",
-		reactorDisplayName,
-		emoji,
-	)
-
-	body := postText
-
-	if len(body) > 100 {
-		body = body[:97] + "..."
-	}
-
-	data := map[string]string{
-		"type":          "post_reaction",
-		"post_id":       strconv.Itoa(postID),
-		"reactor_id":    strconv.Itoa(reactorUserID),
-		"reaction_type": reactionType,
-		"post_owner_id": strconv.Itoa(postOwnerID),
-	}
-
-	successCount, failureCount, err := services.SendMultipleNotifications(
-		db,
-		tokens,
-		title,
-		body,
-		data,
-	)
-
-	if err != nil {
-		log.Printf(
-			"Error sending reaction notification: %v",
-			err,
-		)
-		return
-	}
-
-	log.Printf(
-		"Sent reaction notification for post %d: %d successful, %d failed",
-		postID,
-		successCount,
-		failureCount,
-	)
+	return deliverNotification(db, push, notification{
+		UserID:     postOwnerID,
+		ActorID:    reactorUserID,
+		Type:       "post_reaction",
+		TargetType: "post",
+		TargetID:   postID,
+		Title: fmt.Sprintf(
+			"%s reacted %s to your post",
+			reactorDisplayName,
+			emoji,
+		),
+		Body: truncateForPush(postText),
+		Data: map[string]string{
+			"type":          "post_reaction",
+			"post_id":       strconv.Itoa(postID),
+			"reactor_id":    strconv.Itoa(reactorUserID),
+			"reaction_type": reactionType,
+			"post_owner_id": strconv.Itoa(postOwnerID),
+		},
+		GroupKey: "post_reaction:post:" + strconv.Itoa(postID),
+		GroupTitle: func(others int) string {
+			return andOthers(reactorDisplayName, others) + " reacted to your post"
+		},
+		DedupeKey: eventKey,
+	})
 }
 
-func notifyPostOwnerOfComment(db *sql.DB, postID int, commenterUserID int, commentText string) {
+func notifyPostOwnerOfComment(db *sql.DB, push services.PushSender, eventKey string, postID int, commenterUserID int, commentText string) error {
 	var postOwnerID int
-	var postText string
-	var commenterDisplayName string
 
 	err := db.QueryRow(`
-		SELECT user_id, text 
+		SELECT user_id 
 		FROM posts 
-		WHERE id = $1`, postID).Scan(&postOwnerID, &postText)
-
-	if err != nil {
-		log.Printf("Error fetching post info for comment notification: %v", err)
-		return
-	}
-
-	if postOwnerID == commenterUserID {
-		return
-	}
-
-	err = db.QueryRow(`
-		SELECT display_name 
-		FROM users 
-		WHERE id = $1`, commenterUserID).Scan(&commenterDisplayName)
+		WHERE id = $1`, postID).Scan(&postOwnerID)
 
-	if err != nil {
-		log.Printf("Error fetching commenter display name: %v", err)
-		commenterDisplayName = "Someone"
+	if err == sql.ErrNoRows {
+		return nil
 	}
-
-	rows, err := db.Query(`
-		SELECT token 
-		FROM fcm_tokens 
-		WHERE user_id = $1 
-		  AND token IS NOT NULL 
-		  AND token != ''`,
-		postOwnerID)
-
 	if err != nil {
-		log.Printf("Error fetching post owner FCM tokens: %v", err)
-		return
+		return fmt.Errorf("failed to fetch post for comment notification: %w", err)
 	}
-	defer rows.Close()
 
-	var tokens []string
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			log.Printf("Error scanning FCM token: %v", err)
-			continue
-		}
-		tokens = append(tokens, token)
-	}
-
-	if len(tokens) == 0 {
-		log.Printf("No FCM tokens found for post owner %d", postOwnerID)
-		return
-	}
-
-	title := fmt.Sprintf("%s commented on your post", commenterDisplayName)
-	body := commentText
-	if len(body) > 100 {
-		body = body[:97] + "..."
-	}
-
-	data := map[string]string{
-		"type":          "post_comment",
-		"post_id":       strconv.Itoa(postID),
-		"commenter_id":  strconv.Itoa(commenterUserID),
-		"post_owner_id": strconv.Itoa(postOwnerID),
-		"comment_text":  commentText,
+	if postOwnerID == commenterUserID {
+		return nil
 	}
 
-	successCount, failureCount, err := services.SendMultipleNotifications(db, tokens, title, body, data)
-	if err != nil {
-		log.Printf("Error sending comment notification: %v", err)
-		return
+	if blocked, err := isBlockedEitherWay(db, commenterUserID, postOwnerID); err != nil || blocked {
+		return err
 	}
 
-	log.Printf("Sent comment notification for post %d: %d successful, %d failed",
-		postID, successCount, failureCount)
+	commenterDisplayName := fetchDisplayName(db, commenterUserID, "Someone")
+
+	return deliverNotification(db, push, notification{
+		UserID:     postOwnerID,
+		ActorID:    commenterUserID,
+		Type:       "post_comment",
+		TargetType: "post",
+		TargetID:   postID,
+		Title:      fmt.Sprintf("%s commented on your post", commenterDisplayName),
+		Body:       truncateForPush(commentText),
+		Data: map[string]string{
+			"type":          "post_comment",
+			"post_id":       strconv.Itoa(postID),
+			"commenter_id":  strconv.Itoa(commenterUserID),
+			"post_owner_id": strconv.Itoa(postOwnerID),
+			"comment_text":  commentText,
+		},
+		GroupKey: "post_comment:post:" + strconv.Itoa(postID),
+		GroupTitle: func(others int) string {
+			return andOthers(commenterDisplayName, others) + " commented on your post"
+		},
+		DedupeKey: eventKey,
+	})
 }
 
 func LikeComment(db *sql.DB) http.HandlerFunc {
@@ -1141,14 +1304,22 @@ func LikeComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Transaction error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
 		var likeID int
-		err = db.QueryRow(`
+		err = tx.QueryRow(`
 			SELECT id FROM comment_likes
 			WHERE user_id = $1 AND comment_id = $2`,
 			req.UserID, commentID).Scan(&likeID)
 
-		if err == sql.ErrNoRows {
-			err = db.QueryRow(`
+		liked := err == sql.ErrNoRows
+		if liked {
+			err = tx.QueryRow(`
 				INSERT INTO comment_likes (user_id, comment_id)
 				VALUES ($1, $2)
 				RETURNING id`,
@@ -1158,21 +1329,39 @@ func LikeComment(db *sql.DB) http.HandlerFunc {
 				log.Println("LikeComment insert error:", err)
 				return
 			}
-			go AddReflectoScore(db, req.UserID, ActionLike, nil, nil)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"liked": true})
+			err = enqueueEvent(tx, eventScoreAdd, "comment_like:"+strconv.Itoa(likeID), scoreEvent{
+				UserID: req.UserID, Action: ActionLike, CommentID: &commentID,
+			})
+			if err != nil {
+				http.Error(w, "Failed to like comment", http.StatusInternalServerError)
+				log.Println("LikeComment outbox error:", err)
+				return
+			}
 		} else if err != nil {
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		} else {
-			_, err = db.Exec(`DELETE FROM comment_likes WHERE id = $1`, likeID)
+			_, err = tx.Exec(`DELETE FROM comment_likes WHERE id = $1`, likeID)
 			if err != nil {
 				http.Error(w, "Failed to unlike comment", http.StatusInternalServerError)
 				return
 			}
-			go SubtractReflectoScore(db, req.UserID, ActionLike, nil)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"liked": false})
+			err = enqueueEvent(tx, eventScoreSubtract, "comment_like:"+strconv.Itoa(likeID), scoreEvent{
+				UserID: req.UserID, Action: ActionLike, CommentID: &commentID,
+			})
+			if err != nil {
+				http.Error(w, "Failed to unlike comment", http.StatusInternalServerError)
+				log.Println("LikeComment outbox error:", err)
+				return
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"liked": liked})
 	}
 }
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,20 +14,22 @@ import (
 )
 
 const (
-	ScorePost     = 5
-	ScoreComment  = 2
-	ScoreLike     = 1
-	ScoreReaction = 1
-	ScoreDecay    = -1
+	ScorePost      = 5
+	ScoreComment   = 2
+	ScoreLike      = 1
+	ScoreReaction  = 1
+	ScoreChallenge = 25
+	ScoreDecay     = -1
 )
 
 type ActionType string
 
 const (
-	ActionPost     ActionType = "post"
-	ActionComment  ActionType = "comment"
-	ActionLike     ActionType = "like"
-	ActionReaction ActionType = "reaction"
+	ActionPost      ActionType = "post"
+	ActionComment   ActionType = "comment"
+	ActionLike      ActionType = "like"
+	ActionReaction  ActionType = "reaction"
+	ActionChallenge ActionType = "challenge"
 )
 
 type ReflectoScore struct {
@@ -76,131 +80,406 @@ func GetUserReflectoScore(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func SubtractReflectoScore(db *sql.DB, userID int, action ActionType, postID *int) {
-	if action != ActionPost && postID != nil {
-		_, err := db.Exec(`
+// ledgerDecay is the score_ledger action for points lost to decay; the
+// other actions are the ActionTypes.
+const ledgerDecay = "decay"
+
+// scoreSource is what a score_ledger row points back to: the post, comment
+// or journal day it was for, and the scoring rules version that priced it.
+type scoreSource struct {
+	PostID      *int
+	CommentID   *int
+	JournalDate *time.Time
+	RuleVersion int
+}
+
+// applyScoreChange adds points to the user's score without taking it below
+// zero, and appends the change actually applied to score_ledger, which it
+// returns.
+func applyScoreChange(tx *sql.Tx, userID int, action string, points int, src scoreSource) (int, error) {
+	var score int
+	err := tx.QueryRow(`
+		INSERT INTO reflecto_scores (user_id, score, updated_at)
+		VALUES ($1, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING score`,
+		userID).Scan(&score)
+	if err != nil {
+		return 0, fmt.Errorf("score lock: %w", err)
+	}
+
+	if score+points < 0 {
+		points = -score
+	}
+	if points == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE reflecto_scores
+		SET score = score + $2, updated_at = NOW()
+		WHERE user_id = $1`,
+		userID, points)
+	if err != nil {
+		return 0, fmt.Errorf("score update: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO score_ledger (user_id, action, points, post_id, comment_id, journal_date, rule_version)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))`,
+		userID, action, points, src.PostID, src.CommentID, src.JournalDate, src.RuleVersion)
+	if err != nil {
+		return 0, fmt.Errorf("ledger insert: %w", err)
+	}
+	return points, nil
+}
+
+// SubtractReflectoScore takes back the points for a deleted action: what the
+// ledger says it earned, whatever the rules say now. When the action was tied
+// to a post, points are only taken back if its score event was still
+// recorded, which keeps a retried subtraction from applying twice.
+func SubtractReflectoScore(db *sql.DB, userID int, action ActionType, postID, commentID *int) error {
+	if !isScoredAction(action) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if postID != nil {
+		result, err := tx.Exec(`
             DELETE FROM reflecto_score_events
             WHERE user_id = $1 AND post_id = $2 AND action_type = $3
         `, userID, *postID, string(action))
 		if err != nil {
-			log.Printf("❌ SubtractReflectoScore event delete error: %v", err)
+			return fmt.Errorf("score event delete: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			log.Printf("⏭️ No score recorded for user=%d post=%d action=%s — skipping", userID, *postID, action)
+			return nil
 		}
 	}
 
-	points := pointsForAction(action)
-	if points == 0 {
-		return
+	points, err := awardedPoints(tx, userID, action, postID, commentID)
+	if err != nil {
+		return err
 	}
 
 	log.Printf("📉 SubtractReflectoScore: user=%d action=%s points=-%d", userID, action, points)
 
-	_, err := db.Exec(`
-        UPDATE reflecto_scores
-        SET score      = GREATEST(0, score - $1),
-            updated_at = NOW()
-        WHERE user_id  = $2
-    `, points, userID)
+	applied, err := applyScoreChange(tx, userID, string(action), -points,
+		scoreSource{PostID: postID, CommentID: commentID})
 	if err != nil {
-		log.Printf("❌ SubtractReflectoScore error: %v", err)
-	} else {
-		log.Printf("✅ Score decremented for user %d (-%d for deleting %s)", userID, points, action)
+		return err
 	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Score decremented for user %d (%d for deleting %s)", userID, applied, action)
+	return nil
 }
 
-func AddReflectoScore(db *sql.DB, userID int, action ActionType, postDate *time.Time, postID *int) {
-	points := pointsForAction(action)
-	if points == 0 {
-		log.Printf("⚠️ Unknown action type: %s", action)
-		return
+// AddReflectoScore awards the points the current scoring rules give an
+// action. Actions tied to a post (including the post itself) are recorded in
+// reflecto_score_events in the same transaction, so each is scored at most
+// once even if retried.
+func AddReflectoScore(db *sql.DB, userID int, action ActionType, postDate *time.Time, postID, commentID *int) error {
+	return addReflectoScore(db, userID, action, postDate, postID, commentID, "", nil)
+}
+
+// addReflectoScore is AddReflectoScore for the outbox. Actions without a post
+// are deduplicated on eventKey through score_event_keys instead, and then, if
+// set, runs in the score's transaction, so follow-up work commits with it.
+func addReflectoScore(db *sql.DB, userID int, action ActionType, postDate *time.Time, postID, commentID *int,
+	eventKey string, then func(tx *sql.Tx) error) error {
+	if !isScoredAction(action) {
+		return fmt.Errorf("unknown action type: %s", action)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if postID == nil && eventKey != "" {
+		result, err := tx.Exec(`
+			INSERT INTO score_event_keys (event_key, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (event_key) DO NOTHING`,
+			eventKey, userID)
+		if err != nil {
+			return fmt.Errorf("score event key insert: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			log.Printf("⏭️ Score already awarded for user=%d event=%s — skipping", userID, eventKey)
+			return nil
+		}
 	}
 
-	if action != ActionPost && postID != nil {
-		result, err := db.Exec(`
+	if postID != nil {
+		result, err := tx.Exec(`
             INSERT INTO reflecto_score_events (user_id, post_id, action_type)
             VALUES ($1, $2, $3)
             ON CONFLICT (user_id, post_id, action_type) DO NOTHING
         `, userID, *postID, string(action))
 		if err != nil {
-			log.Printf("❌ AddReflectoScore event insert error: %v", err)
-			return
+			return fmt.Errorf("score event insert: %w", err)
 		}
 		rows, _ := result.RowsAffected()
 		if rows == 0 {
 			log.Printf("⏭️ Score already awarded for user=%d post=%d action=%s — skipping", userID, *postID, action)
-			return
+			return nil
 		}
 	}
 
-	log.Printf("🌟 AddReflectoScore: user=%d action=%s points=%d", userID, action, points)
+	rules, version, err := loadScoringRules(tx, time.Now())
+	if err != nil {
+		return fmt.Errorf("scoring rules: %w", err)
+	}
+	input, err := liveScoreInput(tx, userID, action, postID, postDate)
+	if err != nil {
+		return err
+	}
+	points := rules.Price(input)
+
+	log.Printf("🌟 AddReflectoScore: user=%d action=%s points=%d (rules v%d)", userID, action, points, version)
 
+	var journalDate *time.Time
 	if action == ActionPost && postDate != nil {
-		dateStr := postDate.UTC().Format("2006-01-02")
-		_, err := db.Exec(`
-            INSERT INTO reflecto_scores (user_id, score, last_post_date, updated_at)
-            VALUES ($1, $2, $3, NOW())
-            ON CONFLICT (user_id) DO UPDATE
-            SET score          = GREATEST(0, reflecto_scores.score + $2),
-                last_post_date = CASE
-                    WHEN $3::date > reflecto_scores.last_post_date OR reflecto_scores.last_post_date IS NULL
-                    THEN $3::date
-                    ELSE reflecto_scores.last_post_date
-                END,
-                updated_at     = NOW()
-        `, userID, points, dateStr)
+		d := postDate.UTC().Truncate(24 * time.Hour)
+		journalDate = &d
+	}
+
+	if _, err := applyScoreChange(tx, userID, string(action), points,
+		scoreSource{PostID: postID, CommentID: commentID, JournalDate: journalDate, RuleVersion: version}); err != nil {
+		return err
+	}
+
+	if journalDate != nil {
+		_, err = tx.Exec(`
+            UPDATE reflecto_scores
+            SET last_post_date = GREATEST(last_post_date, $2::date)
+            WHERE user_id = $1
+        `, userID, journalDate.Format("2006-01-02"))
 		if err != nil {
-			log.Printf("❌ AddReflectoScore (post) error: %v", err)
-		} else {
-			log.Printf("✅ Score updated for user %d (+%d for %s)", userID, points, action)
+			return fmt.Errorf("last post date update: %w", err)
 		}
-		return
 	}
 
-	_, err := db.Exec(`
-        INSERT INTO reflecto_scores (user_id, score, updated_at)
-        VALUES ($1, $2, NOW())
-        ON CONFLICT (user_id) DO UPDATE
-        SET score      = GREATEST(0, reflecto_scores.score + $2),
-            updated_at = NOW()
-    `, userID, points)
+	if then != nil {
+		if err := then(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Score updated for user %d (+%d for %s)", userID, points, action)
+	return nil
+}
+
+// ApplyDailyDecay applies the scoring rules' decay to users for every journal day
+// they finished without posting. A journal day only ends at noon local time
+// the following day (see ComputeJournalDate), so the job runs often and
+// leaves alone users whose day is still open. Each user's progress is kept in
+// reflecto_scores.decayed_through and each decayed day in score_decays, so
+// reruns are no-ops and days missed while the scheduler was down are applied
+// on its next run. Once ctx is done it stops, leaving the remaining users for
+// the next run.
+func ApplyDailyDecay(ctx context.Context, db *sql.DB) error {
+	nowUTC := time.Now().UTC()
+
+	// No journal day anywhere ends after today's date in UTC (UTC+14 finishes
+	// day D at 22:00 UTC on D), so users evaluated through it need no look.
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.user_id, s.decayed_through, COALESCE(u.timezone, 'UTC')
+		FROM reflecto_scores s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.decayed_through < ($1::timestamptz AT TIME ZONE 'UTC')::date`,
+		nowUTC)
 	if err != nil {
-		log.Printf("❌ AddReflectoScore error: %v", err)
-	} else {
-		log.Printf("✅ Score updated for user %d (+%d for %s)", userID, points, action)
+		return fmt.Errorf("failed to fetch users to decay: %w", err)
+	}
+
+	type candidate struct {
+		userID         int
+		decayedThrough time.Time
+		timezone       string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.userID, &c.decayedThrough, &c.timezone); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	var users, points int
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			log.Printf("[ScoreDecay] Stopped after taking %d point(s) from %d users", points, users)
+			return err
+		}
+
+		today, err := ComputeJournalDate(nowUTC, c.timezone)
+		if err != nil {
+			log.Printf("[ScoreDecay] Bad timezone %q for user %d: %v", c.timezone, c.userID, err)
+			continue
+		}
+		lastFinished := today.AddDate(0, 0, -1)
+		if !lastFinished.After(c.decayedThrough) {
+			continue
+		}
+
+		taken, err := decayUserThrough(ctx, db, c.userID, lastFinished)
+		if err != nil {
+			log.Printf("[ScoreDecay] Failed for user %d: %v", c.userID, err)
+			continue
+		}
+		if taken > 0 {
+			users++
+			points += taken
+		}
 	}
+
+	log.Printf("[ScoreDecay] Evaluated %d users, took %d point(s) from %d", len(candidates), points, users)
+	return nil
 }
 
-func ApplyDailyDecay(db *sql.DB) {
-	today := time.Now().UTC().Format("2006-01-02")
-	log.Printf("📉 ApplyDailyDecay running for date: %s", today)
+// decayUserThrough applies decay for every unposted journal day after the
+// user's decayed_through up to and including lastFinished, and returns the
+// points taken. Days on which the score was already zero cost nothing and
+// leave no score_decays row.
+func decayUserThrough(ctx context.Context, db *sql.DB, userID int, lastFinished time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	result, err := db.Exec(`
-		UPDATE reflecto_scores
-		SET score      = GREATEST(0, score + $1),
-		    updated_at = NOW()
-		WHERE last_post_date IS NULL
-		   OR last_post_date < $2::date
-	`, ScoreDecay, today)
+	// Re-read under lock; a concurrent run may already have moved on.
+	var score int
+	var decayedThrough time.Time
+	err = tx.QueryRow(`
+		SELECT score, decayed_through FROM reflecto_scores
+		WHERE user_id = $1
+		FOR UPDATE`,
+		userID).Scan(&score, &decayedThrough)
+	if err != nil {
+		return 0, err
+	}
+	if !lastFinished.After(decayedThrough) {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT d::date
+		FROM generate_series($2::date + 1, $3::date, INTERVAL '1 day') AS d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM posts p WHERE p.user_id = $1 AND p.journal_date = d::date
+		)
+		ORDER BY d`,
+		userID, decayedThrough, lastFinished)
+	if err != nil {
+		return 0, err
+	}
+	var missed []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		missed = append(missed, d)
+	}
+	rows.Close()
+
+	taken := 0
+	for _, day := range missed {
+		// Decay for a day follows the rules in effect when it ended.
+		rules, version, err := loadScoringRules(tx, day.AddDate(0, 0, 1))
+		if err != nil {
+			return 0, err
+		}
+		points := rules.Decay
+		if score+points < 0 {
+			points = -score
+		}
+		if points == 0 {
+			continue
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO score_decays (user_id, journal_date, points)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, journal_date) DO NOTHING`,
+			userID, day, points)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO score_ledger (user_id, action, points, journal_date, rule_version)
+			VALUES ($1, $2, $3, $4, NULLIF($5, 0))`,
+			userID, ledgerDecay, points, day, version)
+		if err != nil {
+			return 0, err
+		}
+		score += points
+		taken -= points
+	}
 
+	_, err = tx.Exec(`
+		UPDATE reflecto_scores
+		SET score           = $2,
+		    decayed_through = $3,
+		    updated_at      = CASE WHEN score = $2 THEN updated_at ELSE NOW() END
+		WHERE user_id = $1`,
+		userID, score, lastFinished)
 	if err != nil {
-		log.Printf("❌ ApplyDailyDecay error: %v", err)
-		return
+		return 0, err
 	}
 
-	rows, _ := result.RowsAffected()
-	log.Printf("✅ ApplyDailyDecay: decayed %d users by %d point(s)", rows, -ScoreDecay)
+	return taken, tx.Commit()
 }
 
-func pointsForAction(action ActionType) int {
-	switch action {
-	case ActionPost:
-		return ScorePost
-	case ActionComment:
-		return ScoreComment
-	case ActionLike:
-		return ScoreLike
-	case ActionReaction:
-		return ScoreReaction
-	default:
-		return 0
+// awardedPoints returns the points a scored action still holds according to
+// the ledger: its awards less anything already taken back. Post-linked
+// actions are matched on the post, as reflecto_score_events dedupes them;
+// comment likes on the comment. Awards from before the ledger existed fall
+// back to the action's current base points.
+func awardedPoints(tx *sql.Tx, userID int, action ActionType, postID, commentID *int) (int, error) {
+	var entries, points int
+	err := tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(points), 0)
+		FROM score_ledger
+		WHERE user_id = $1 AND action = $2
+		  AND CASE WHEN $3::int IS NOT NULL THEN post_id = $3 ELSE comment_id = $4 END`,
+		userID, string(action), postID, commentID).Scan(&entries, &points)
+	if err != nil {
+		return 0, fmt.Errorf("ledger lookup: %w", err)
+	}
+	if entries > 0 {
+		return points, nil
+	}
+
+	rules, _, err := loadScoringRules(tx, time.Now())
+	if err != nil {
+		return 0, err
 	}
+	return rules.Points[action], nil
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"strconv"
@@ -9,102 +10,76 @@ import (
 	"masterboxer.com/project-micro-journal/services"
 )
 
-func SendScoreDecayNotifications(db *sql.DB) {
-	nowUTC := time.Now().UTC()
-	log.Printf("[ScoreDecayReminder] Job started | nowUTC=%s", nowUTC.Format(time.RFC3339))
-
-	rows, err := db.Query(`
-		SELECT rs.user_id, rs.last_post_date, rs.score, u.timezone
-		FROM reflecto_scores rs
-		JOIN users u ON u.id = rs.user_id
-		WHERE rs.score > 0
-		  AND u.timezone IS NOT NULL
-	`)
-	if err != nil {
-		log.Printf("[ScoreDecayReminder] DB query failed: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var userID int
-		var lastPostDate sql.NullString
-		var score int
-		var timezone string
-
-		if err := rows.Scan(&userID, &lastPostDate, &score, &timezone); err != nil {
-			continue
-		}
-
-		loc, err := time.LoadLocation(timezone)
-		if err != nil {
-			continue
-		}
-
-		localNow := nowUTC.In(loc)
-
-		// Only between 11:00 AM and 11:15 AM local time
-		if localNow.Hour() != 11 || localNow.Minute() > 15 {
-			continue
-		}
-
-		journalToday, err := ComputeJournalDate(nowUTC, timezone)
-		if err != nil {
-			continue
-		}
-
-		// Skip if they've already posted today
-		if lastPostDate.Valid {
-			t, err := time.Parse("2006-01-02", lastPostDate.String[:10])
-			if err == nil && !t.Before(journalToday) {
-				continue
+func SendScoreDecayNotifications(ctx context.Context, db *sql.DB, push services.PushSender) error {
+	return processDueReminders(ctx, db, "score_decay_warning", "[ScoreDecayReminder]",
+		func(userID int, timezone string, nowUTC time.Time) (bool, error) {
+			var lastPostDate sql.NullString
+			var score int
+			err := db.QueryRow(`
+				SELECT last_post_date, score
+				FROM reflecto_scores
+				WHERE user_id = $1
+			`, userID).Scan(&lastPostDate, &score)
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
 			}
-		}
 
-		tokenRows, err := db.Query(`
-			SELECT token
-			FROM fcm_tokens
-			WHERE user_id = $1
-			  AND token IS NOT NULL
-			  AND token != ''
-		`, userID)
-		if err != nil {
-			continue
-		}
+			// Nothing to lose yet
+			if score <= 0 {
+				return false, nil
+			}
 
-		var tokens []string
-		for tokenRows.Next() {
-			var token string
-			if err := tokenRows.Scan(&token); err == nil {
-				tokens = append(tokens, token)
+			journalToday, err := ComputeJournalDate(nowUTC, timezone)
+			if err != nil {
+				return false, err
 			}
-		}
-		tokenRows.Close()
 
-		if len(tokens) == 0 {
-			continue
-		}
+			// Skip if they've already posted today
+			if lastPostDate.Valid {
+				t, err := time.Parse("2006-01-02", lastPostDate.String[:10])
+				if err == nil && !t.Before(journalToday) {
+					return false, nil
+				}
+			}
 
-		success, failure, err := services.SendMultipleNotifications(
-			db,
-			tokens,
-			"📉 Your Reflecto Score is at risk!",
-			"Post today to protect your score of "+strconv.Itoa(score)+" — missing a day costs you a point.",
-			map[string]string{
-				"type":    "score_decay_warning",
-				"user_id": strconv.Itoa(userID),
-			},
-		)
-		if err != nil {
-			log.Printf("[ScoreDecayReminder] FCM error user=%d: %v", userID, err)
-			continue
-		}
+			rules, _, err := loadScoringRules(db, nowUTC)
+			if err != nil {
+				return false, err
+			}
+			// Decay is off under the current rules, so nothing is at risk.
+			cost := -rules.Decay
+			if cost <= 0 {
+				return false, nil
+			}
+			costText := strconv.Itoa(cost) + " points"
+			if cost == 1 {
+				costText = "a point"
+			}
 
-		log.Printf(
-			"[ScoreDecayReminder] Sent decay warning | user=%d score=%d success=%d failure=%d",
-			userID, score, success, failure,
-		)
-	}
+			success, failure, err := sendPush(
+				db,
+				push,
+				userID,
+				"score_decay_warning",
+				"📉 Your Reflecto Score is at risk!",
+				"Post today to protect your score of "+strconv.Itoa(score)+" — missing a day costs you "+costText+".",
+				map[string]string{
+					"type":    "score_decay_warning",
+					"user_id": strconv.Itoa(userID),
+				},
+				"score_decay_warning",
+			)
+			if err != nil {
+				return false, err
+			}
 
-	log.Println("[ScoreDecayReminder] Job finished")
+			log.Printf(
+				"[ScoreDecayReminder] Sent decay warning | user=%d score=%d success=%d failure=%d",
+				userID, score, success, failure,
+			)
+			return success > 0, nil
+		})
 }
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// reminderTypes lists the reminders a user can schedule, in display order.
+var reminderTypes = []string{"daily_reminder", "score_decay_warning", memoriesType}
+
+// reminderDefaults is the local time each reminder fires at until the user
+// picks their own.
+var reminderDefaults = map[string]string{
+	"daily_reminder":      "21:00",
+	"score_decay_warning": "11:00",
+	memoriesType:          "08:00",
+}
+
+// optInReminders start out disabled until the user turns them on.
+var optInReminders = map[string]bool{
+	memoriesType: true,
+}
+
+// A reminder found overdue by more than this (the scheduler was down, say) is
+// rolled forward without sending, so nobody gets a 9 PM nudge at 3 AM.
+const reminderGracePeriod = 2 * time.Hour
+
+type reminderSetting struct {
+	Type       string     `json:"type"`
+	LocalTime  string     `json:"local_time"`
+	Enabled    bool       `json:"enabled"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	NextDueAt  time.Time  `json:"next_due_at"`
+}
+
+func isReminderType(t string) bool {
+	_, ok := reminderDefaults[t]
+	return ok
+}
+
+// nextReminderDue returns the first instant strictly after `after` at which the
+// wall clock in timezone reads localTime (HH:MM), in UTC.
+func nextReminderDue(localTime, timezone string, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	clock, err := time.Parse("15:04", localTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid local time %q: %w", localTime, err)
+	}
+
+	localAfter := after.In(loc)
+	due := time.Date(localAfter.Year(), localAfter.Month(), localAfter.Day(),
+		clock.Hour(), clock.Minute(), 0, 0, loc)
+	if !due.After(after) {
+		due = time.Date(localAfter.Year(), localAfter.Month(), localAfter.Day()+1,
+			clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+
+	return due.UTC(), nil
+}
+
+// ensureDefaultReminders creates the default reminderType row for every user
+// that doesn't have one yet, or only for userID when it is non-zero.
+func ensureDefaultReminders(db *sql.DB, reminderType string, userID int) error {
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.timezone, 'UTC')
+		FROM users u
+		WHERE ($2 = 0 OR u.id = $2)
+		  AND NOT EXISTS (
+			SELECT 1 FROM user_reminders r
+			WHERE r.user_id = u.id AND r.reminder_type = $1
+		  )`,
+		reminderType, userID)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		userID   int
+		timezone string
+	}
+	var missing []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.userID, &p.timezone); err != nil {
+			rows.Close()
+			return err
+		}
+		missing = append(missing, p)
+	}
+	rows.Close()
+
+	localTime := reminderDefaults[reminderType]
+	nowUTC := time.Now().UTC()
+	for _, p := range missing {
+		nextDue, err := nextReminderDue(localTime, p.timezone, nowUTC)
+		if err != nil {
+			log.Printf("[Reminders] Skipping defaults for user %d: %v", p.userID, err)
+			continue
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO user_reminders (user_id, reminder_type, local_time, next_due_at, enabled)
+			VALUES ($1, $2, $3::time, $4, $5)
+			ON CONFLICT (user_id, reminder_type) DO NOTHING`,
+			p.userID, reminderType, localTime, nextDue, !optInReminders[reminderType])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// processDueReminders claims every enabled reminderType row whose next_due_at
+// has passed and hands it to send. A row is claimed by moving next_due_at to
+// the following occurrence, conditioned on the value we read, so overlapping
+// or repeated runs can never send the same occurrence twice, and a run that
+// comes late still picks up everything due since the last one. Once ctx is
+// done it stops claiming, leaving the rest due for the next run.
+func processDueReminders(
+	ctx context.Context,
+	db *sql.DB,
+	reminderType, logPrefix string,
+	send func(userID int, timezone string, nowUTC time.Time) (bool, error),
+) error {
+	nowUTC := time.Now().UTC()
+	log.Printf("%s Job started at %v UTC", logPrefix, nowUTC)
+
+	if err := ensureDefaultReminders(db, reminderType, 0); err != nil {
+		log.Printf("%s Failed to create default reminders: %v", logPrefix, err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.user_id, to_char(r.local_time, 'HH24:MI'), r.next_due_at, COALESCE(u.timezone, 'UTC')
+		FROM user_reminders r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.reminder_type = $1
+		  AND r.enabled
+		  AND r.next_due_at <= $2`,
+		reminderType, nowUTC)
+	if err != nil {
+		return fmt.Errorf("failed to fetch due reminders: %w", err)
+	}
+
+	type dueReminder struct {
+		userID    int
+		localTime string
+		dueAt     time.Time
+		timezone  string
+	}
+	var due []dueReminder
+	for rows.Next() {
+		var d dueReminder
+		if err := rows.Scan(&d.userID, &d.localTime, &d.dueAt, &d.timezone); err != nil {
+			log.Printf("%s Scan error: %v", logPrefix, err)
+			continue
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	var claimed, sent int
+	for _, d := range due {
+		if err := ctx.Err(); err != nil {
+			log.Printf("%s Job stopped | Claimed %d reminders, sent %d", logPrefix, claimed, sent)
+			return err
+		}
+
+		nextDue, err := nextReminderDue(d.localTime, d.timezone, nowUTC)
+		if err != nil {
+			log.Printf("%s Cannot schedule user %d: %v", logPrefix, d.userID, err)
+			continue
+		}
+
+		result, err := db.ExecContext(ctx, `
+			UPDATE user_reminders
+			SET next_due_at = $1, updated_at = NOW()
+			WHERE user_id = $2 AND reminder_type = $3 AND next_due_at = $4`,
+			nextDue, d.userID, reminderType, d.dueAt)
+		if err != nil {
+			log.Printf("%s Claim failed for user %d: %v", logPrefix, d.userID, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			// Another run got here first.
+			continue
+		}
+		claimed++
+
+		if nowUTC.Sub(d.dueAt) > reminderGracePeriod {
+			log.Printf("%s User %d reminder was due at %v, too late to send",
+				logPrefix, d.userID, d.dueAt)
+			continue
+		}
+
+		delivered, err := send(d.userID, d.timezone, nowUTC)
+		if err != nil {
+			log.Printf("%s Send failed for user %d: %v", logPrefix, d.userID, err)
+			continue
+		}
+		if !delivered {
+			continue
+		}
+
+		_, err = db.Exec(`
+			UPDATE user_reminders SET last_sent_at = $1
+			WHERE user_id = $2 AND reminder_type = $3`,
+			nowUTC, d.userID, reminderType)
+		if err != nil {
+			log.Printf("%s Failed to record send for user %d: %v", logPrefix, d.userID, err)
+		}
+		sent++
+	}
+
+	log.Printf("%s Job finished | Claimed %d reminders, sent %d", logPrefix, claimed, sent)
+	return nil
+}
+
+func loadReminderSettings(db *sql.DB, userID int) ([]reminderSetting, error) {
+	for _, t := range reminderTypes {
+		if err := ensureDefaultReminders(db, t, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT reminder_type, to_char(local_time, 'HH24:MI'), enabled, last_sent_at, next_due_at
+		FROM user_reminders
+		WHERE user_id = $1`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byType := make(map[string]reminderSetting)
+	for rows.Next() {
+		var s reminderSetting
+		if err := rows.Scan(&s.Type, &s.LocalTime, &s.Enabled, &s.LastSentAt, &s.NextDueAt); err != nil {
+			return nil, err
+		}
+		byType[s.Type] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := []reminderSetting{}
+	for _, t := range reminderTypes {
+		if s, ok := byType[t]; ok {
+			settings = append(settings, s)
+		}
+	}
+	return settings, nil
+}
+
+func GetReminders(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		settings, err := loadReminderSettings(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch reminders", http.StatusInternalServerError)
+			log.Println("GetReminders error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+func UpdateReminders(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Reminders []struct {
+				Type      string  `json:"type"`
+				LocalTime *string `json:"local_time"`
+				Enabled   *bool   `json:"enabled"`
+			} `json:"reminders"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Make sure every row exists so the updates below have something to hit.
+		current, err := loadReminderSettings(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch reminders", http.StatusInternalServerError)
+			log.Println("UpdateReminders load error:", err)
+			return
+		}
+		currentByType := make(map[string]reminderSetting, len(current))
+		for _, s := range current {
+			currentByType[s.Type] = s
+		}
+
+		var timezone string
+		err = db.QueryRow(`SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = $1`, userID).Scan(&timezone)
+		if err != nil {
+			http.Error(w, "Failed to fetch user timezone", http.StatusInternalServerError)
+			log.Println("UpdateReminders timezone error:", err)
+			return
+		}
+
+		nowUTC := time.Now().UTC()
+		for _, update := range req.Reminders {
+			existing, ok := currentByType[update.Type]
+			if !ok || !isReminderType(update.Type) {
+				http.Error(w, "Unknown reminder type: "+update.Type, http.StatusBadRequest)
+				return
+			}
+
+			localTime := existing.LocalTime
+			if update.LocalTime != nil {
+				if _, err := time.Parse("15:04", *update.LocalTime); err != nil {
+					http.Error(w, "local_time must be HH:MM", http.StatusBadRequest)
+					return
+				}
+				localTime = *update.LocalTime
+			}
+
+			enabled := existing.Enabled
+			if update.Enabled != nil {
+				enabled = *update.Enabled
+			}
+
+			nextDue, err := nextReminderDue(localTime, timezone, nowUTC)
+			if err != nil {
+				http.Error(w, "Failed to schedule reminder", http.StatusInternalServerError)
+				log.Println("UpdateReminders schedule error:", err)
+				return
+			}
+
+			_, err = db.Exec(`
+				UPDATE user_reminders
+				SET local_time = $1::time, enabled = $2, next_due_at = $3, updated_at = NOW()
+				WHERE user_id = $4 AND reminder_type = $5`,
+				localTime, enabled, nextDue, userID, update.Type)
+			if err != nil {
+				http.Error(w, "Failed to update reminder", http.StatusInternalServerError)
+				log.Println("UpdateReminders error:", err)
+				return
+			}
+		}
+
+		settings, err := loadReminderSettings(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch reminders", http.StatusInternalServerError)
+			log.Println("UpdateReminders reload error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
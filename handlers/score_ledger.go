@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxScoreHistoryDays caps the range of one history request.
+const maxScoreHistoryDays = 366
+
+type scoreHistoryDay struct {
+	Date   string `json:"date"`
+	Earned int    `json:"earned"`
+	Lost   int    `json:"lost"`
+	Net    int    `json:"net"`
+	// Score is the running score at the end of the day.
+	Score int `json:"score"`
+}
+
+// ledgerDaySQL is the day a score_ledger row counts towards: the journal day
+// it was for, or else the local date it happened on.
+const ledgerDaySQL = `COALESCE(l.journal_date, (l.created_at AT TIME ZONE COALESCE(u.timezone, 'UTC'))::date)`
+
+// GetReflectoScoreHistory returns a user's score changes per day between the
+// optional from/to dates (YYYY-MM-DD), the last 30 days by default. Every day
+// in the range is present, so the result can be charted as is.
+func GetReflectoScoreHistory(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var timezone string
+		err = db.QueryRow(`SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = $1`, userID).Scan(&timezone)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch score history", http.StatusInternalServerError)
+			log.Println("GetReflectoScoreHistory user error:", err)
+			return
+		}
+
+		if to == nil {
+			loc, err := time.LoadLocation(timezone)
+			if err != nil {
+				loc = time.UTC
+			}
+			now := time.Now().In(loc)
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+			to = &today
+		}
+		if from == nil {
+			start := to.AddDate(0, 0, -29)
+			from = &start
+		}
+		if from.After(*to) {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		if to.Sub(*from) >= maxScoreHistoryDays*24*time.Hour {
+			http.Error(w, fmt.Sprintf("Range must be at most %d days", maxScoreHistoryDays), http.StatusBadRequest)
+			return
+		}
+
+		var score int
+		err = db.QueryRow(`
+			SELECT COALESCE(SUM(l.points), 0)
+			FROM score_ledger l
+			JOIN users u ON u.id = l.user_id
+			WHERE l.user_id = $1 AND `+ledgerDaySQL+` < $2::date`,
+			userID, *from).Scan(&score)
+		if err != nil {
+			http.Error(w, "Failed to fetch score history", http.StatusInternalServerError)
+			log.Println("GetReflectoScoreHistory opening error:", err)
+			return
+		}
+
+		rows, err := db.Query(`
+			WITH entries AS (
+				SELECT `+ledgerDaySQL+` AS day, l.points
+				FROM score_ledger l
+				JOIN users u ON u.id = l.user_id
+				WHERE l.user_id = $1
+			)
+			SELECT to_char(d, 'YYYY-MM-DD'),
+			       COALESCE(SUM(e.points) FILTER (WHERE e.points > 0), 0),
+			       COALESCE(-SUM(e.points) FILTER (WHERE e.points < 0), 0)
+			FROM generate_series($2::date, $3::date, INTERVAL '1 day') AS d
+			LEFT JOIN entries e ON e.day = d::date
+			GROUP BY d
+			ORDER BY d`,
+			userID, *from, *to)
+		if err != nil {
+			http.Error(w, "Failed to fetch score history", http.StatusInternalServerError)
+			log.Println("GetReflectoScoreHistory query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		days := []scoreHistoryDay{}
+		for rows.Next() {
+			var d scoreHistoryDay
+			if err := rows.Scan(&d.Date, &d.Earned, &d.Lost); err != nil {
+				http.Error(w, "Failed to fetch score history", http.StatusInternalServerError)
+				log.Println("GetReflectoScoreHistory scan error:", err)
+				return
+			}
+			d.Net = d.Earned - d.Lost
+			score += d.Net
+			d.Score = score
+			days = append(days, d)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id": userID,
+			"from":    from.Format("2006-01-02"),
+			"to":      to.Format("2006-01-02"),
+			"days":    days,
+		})
+	}
+}
+
+// ScoreDrift is a user whose stored score disagreed with their ledger.
+type ScoreDrift struct {
+	UserID  int
+	Stored  int
+	Derived int
+}
+
+// RecomputeReflectoScores resets reflecto_scores.score to the sum of each
+// user's score_ledger rows, for one user or for everyone when userID is 0,
+// and returns the users whose score had drifted. With dryRun set it only
+// reports them.
+func RecomputeReflectoScores(db *sql.DB, userID int, dryRun bool) ([]ScoreDrift, error) {
+	rows, err := db.Query(`
+		SELECT s.user_id, s.score, COALESCE(SUM(l.points), 0)
+		FROM reflecto_scores s
+		LEFT JOIN score_ledger l ON l.user_id = s.user_id
+		WHERE $1 = 0 OR s.user_id = $1
+		GROUP BY s.user_id, s.score
+		HAVING s.score <> COALESCE(SUM(l.points), 0)
+		ORDER BY s.user_id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []ScoreDrift
+	for rows.Next() {
+		var d ScoreDrift
+		if err := rows.Scan(&d.UserID, &d.Stored, &d.Derived); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return drifts, nil
+	}
+
+	for i, d := range drifts {
+		derived, err := recomputeUserScore(db, d.UserID)
+		if err != nil {
+			return drifts[:i], fmt.Errorf("user %d: %w", d.UserID, err)
+		}
+		drifts[i].Derived = derived
+	}
+	return drifts, nil
+}
+
+func recomputeUserScore(db *sql.DB, userID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the score first so no change lands between summing and writing.
+	if _, err := tx.Exec(`SELECT 1 FROM reflecto_scores WHERE user_id = $1 FOR UPDATE`, userID); err != nil {
+		return 0, err
+	}
+
+	var derived int
+	err = tx.QueryRow(`SELECT GREATEST(0, COALESCE(SUM(points), 0)) FROM score_ledger WHERE user_id = $1`,
+		userID).Scan(&derived)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE reflecto_scores SET score = $2, updated_at = NOW() WHERE user_id = $1`,
+		userID, derived)
+	if err != nil {
+		return 0, err
+	}
+	return derived, tx.Commit()
+}
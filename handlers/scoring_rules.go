@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	multiplierStreak          = "streak"
+	multiplierFirstPostOfWeek = "first_post_of_week"
+	multiplierLongEntry       = "long_entry"
+)
+
+// streakLookbackDays bounds how far back a post's streak is counted.
+const streakLookbackDays = 366
+
+// ScoringRules decide how many points each action is worth. A set of rules
+// is stored as one version in scoring_rule_sets and applies to score changes
+// from its effective_from until the next version takes over.
+type ScoringRules struct {
+	Points map[ActionType]int `json:"points"`
+	// Decay is the (negative) change for a journal day without a post.
+	Decay int `json:"decay"`
+	// DailyCaps limit the points one action type can earn a user in a day.
+	DailyCaps   map[ActionType]int `json:"daily_caps,omitempty"`
+	Multipliers []ScoreMultiplier  `json:"multipliers,omitempty"`
+}
+
+// ScoreMultiplier scales the points for Action when its condition holds.
+// Factors of every matching multiplier are multiplied together.
+type ScoreMultiplier struct {
+	Kind   string     `json:"kind"`
+	Action ActionType `json:"action"`
+	Factor float64    `json:"factor"`
+	// MinDays is the streak length a "streak" multiplier needs.
+	MinDays int `json:"min_days,omitempty"`
+	// MinChars is the entry length a "long_entry" multiplier needs.
+	MinChars int `json:"min_chars,omitempty"`
+}
+
+// DefaultScoringRules apply until a version is stored in scoring_rule_sets.
+func DefaultScoringRules() *ScoringRules {
+	return &ScoringRules{
+		Points: map[ActionType]int{
+			ActionPost:      ScorePost,
+			ActionComment:   ScoreComment,
+			ActionLike:      ScoreLike,
+			ActionReaction:  ScoreReaction,
+			ActionChallenge: ScoreChallenge,
+		},
+		Decay: ScoreDecay,
+	}
+}
+
+func (r *ScoringRules) Validate() error {
+	if len(r.Points) == 0 {
+		return errors.New("points are required")
+	}
+	for action, points := range r.Points {
+		if !isScoredAction(action) {
+			return fmt.Errorf("unknown action %q", action)
+		}
+		if points < 0 {
+			return fmt.Errorf("points for %s must not be negative", action)
+		}
+	}
+	if r.Decay > 0 {
+		return errors.New("decay must not be positive")
+	}
+	for action, limit := range r.DailyCaps {
+		if !isScoredAction(action) {
+			return fmt.Errorf("unknown action %q in daily_caps", action)
+		}
+		if limit < 0 {
+			return fmt.Errorf("daily cap for %s must not be negative", action)
+		}
+	}
+	for _, m := range r.Multipliers {
+		if !isScoredAction(m.Action) {
+			return fmt.Errorf("unknown action %q in multiplier", m.Action)
+		}
+		if m.Factor <= 0 {
+			return fmt.Errorf("%s multiplier factor must be positive", m.Kind)
+		}
+		switch m.Kind {
+		case multiplierStreak:
+			if m.MinDays < 2 {
+				return errors.New("streak multiplier needs min_days of at least 2")
+			}
+		case multiplierLongEntry:
+			if m.MinChars < 1 {
+				return errors.New("long_entry multiplier needs min_chars")
+			}
+		case multiplierFirstPostOfWeek:
+		default:
+			return fmt.Errorf("unknown multiplier kind %q", m.Kind)
+		}
+		// Every multiplier so far describes the entry being posted.
+		if m.Action != ActionPost {
+			return fmt.Errorf("%s multiplier only applies to posts", m.Kind)
+		}
+	}
+	return nil
+}
+
+func isScoredAction(action ActionType) bool {
+	switch action {
+	case ActionPost, ActionComment, ActionLike, ActionReaction, ActionChallenge:
+		return true
+	}
+	return false
+}
+
+// scoreInput is everything the rules look at to price one action.
+type scoreInput struct {
+	Action ActionType
+	// The post-only fields describe the entry being scored.
+	EntryLength     int
+	StreakDays      int
+	FirstPostOfWeek bool
+	// EarnedToday is what Action has already earned the user today.
+	EarnedToday int
+}
+
+// Price returns the points in earns under r, after multipliers and the
+// action's daily cap.
+func (r *ScoringRules) Price(in scoreInput) int {
+	base := r.Points[in.Action]
+	if base == 0 {
+		return 0
+	}
+
+	factor := 1.0
+	for _, m := range r.Multipliers {
+		if m.Action != in.Action {
+			continue
+		}
+		switch {
+		case m.Kind == multiplierStreak && in.StreakDays >= m.MinDays,
+			m.Kind == multiplierFirstPostOfWeek && in.FirstPostOfWeek,
+			m.Kind == multiplierLongEntry && in.EntryLength >= m.MinChars:
+			factor *= m.Factor
+		}
+	}
+	points := int(math.Round(float64(base) * factor))
+
+	if limit, ok := r.DailyCaps[in.Action]; ok {
+		if remaining := limit - in.EarnedToday; points > remaining {
+			points = remaining
+		}
+		if points < 0 {
+			points = 0
+		}
+	}
+	return points
+}
+
+// loadScoringRules returns the rules in effect at t and their version, or
+// DefaultScoringRules and version 0 when none are stored.
+func loadScoringRules(q queryer, t time.Time) (*ScoringRules, int, error) {
+	var version int
+	var raw []byte
+	err := q.QueryRow(`
+		SELECT version, rules FROM scoring_rule_sets
+		WHERE effective_from <= $1
+		ORDER BY effective_from DESC, version DESC
+		LIMIT 1`,
+		t).Scan(&version, &raw)
+	if err == sql.ErrNoRows {
+		return DefaultScoringRules(), 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rules ScoringRules
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, 0, fmt.Errorf("scoring rules v%d: %w", version, err)
+	}
+	return &rules, version, nil
+}
+
+// postScoreInput fills in the post-only fields of a scoreInput from the
+// user's journal dates, which must be sorted ascending and include date.
+func postScoreInput(in scoreInput, journalDates []time.Time, date time.Time, entryLength int) scoreInput {
+	in.EntryLength = entryLength
+
+	posted := make(map[time.Time]bool, len(journalDates))
+	for _, d := range journalDates {
+		posted[d] = true
+	}
+	in.StreakDays = 0
+	for d := date; posted[d]; d = d.AddDate(0, 0, -1) {
+		in.StreakDays++
+	}
+
+	weekStart := date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	in.FirstPostOfWeek = true
+	for _, d := range journalDates {
+		if !d.Before(weekStart) && d.Before(date) {
+			in.FirstPostOfWeek = false
+			break
+		}
+	}
+	return in
+}
+
+// liveScoreInput builds the scoreInput for an action being scored now.
+func liveScoreInput(tx *sql.Tx, userID int, action ActionType, postID *int, postDate *time.Time) (scoreInput, error) {
+	in := scoreInput{Action: action}
+
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(l.points), 0)
+		FROM score_ledger l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.user_id = $1 AND l.action = $2 AND l.points > 0
+		  AND (l.created_at AT TIME ZONE COALESCE(u.timezone, 'UTC'))::date
+		    = (NOW() AT TIME ZONE COALESCE(u.timezone, 'UTC'))::date`,
+		userID, string(action)).Scan(&in.EarnedToday)
+	if err != nil {
+		return in, fmt.Errorf("earned today: %w", err)
+	}
+
+	if action != ActionPost || postID == nil || postDate == nil {
+		return in, nil
+	}
+
+	date := postDate.UTC().Truncate(24 * time.Hour)
+	var entryLength int
+	err = tx.QueryRow(`SELECT COALESCE(char_length(text), 0) FROM posts WHERE id = $1`, *postID).Scan(&entryLength)
+	if err != nil && err != sql.ErrNoRows {
+		return in, fmt.Errorf("entry length: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT journal_date FROM posts
+		WHERE user_id = $1 AND journal_date BETWEEN $2::date - $3::int AND $2::date
+		ORDER BY journal_date`,
+		userID, date, streakLookbackDays)
+	if err != nil {
+		return in, fmt.Errorf("journal dates: %w", err)
+	}
+	defer rows.Close()
+
+	dates := []time.Time{date}
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return in, err
+		}
+		dates = append(dates, d.UTC())
+	}
+	return postScoreInput(in, dates, date, entryLength), rows.Err()
+}
+
+type scoringRuleSet struct {
+	Version       int           `json:"version"`
+	EffectiveFrom time.Time     `json:"effective_from"`
+	Rules         *ScoringRules `json:"rules"`
+	Note          string        `json:"note"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// GetScoringRules lists every version of the scoring rules, newest first.
+func GetScoringRules(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.Query(`
+			SELECT version, effective_from, rules, note, created_at
+			FROM scoring_rule_sets
+			ORDER BY version DESC`)
+		if err != nil {
+			http.Error(w, "Failed to fetch scoring rules", http.StatusInternalServerError)
+			log.Println("GetScoringRules query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		sets := []scoringRuleSet{}
+		for rows.Next() {
+			var s scoringRuleSet
+			var raw []byte
+			if err := rows.Scan(&s.Version, &s.EffectiveFrom, &raw, &s.Note, &s.CreatedAt); err != nil {
+				http.Error(w, "Failed to fetch scoring rules", http.StatusInternalServerError)
+				log.Println("GetScoringRules scan error:", err)
+				return
+			}
+			if err := json.Unmarshal(raw, &s.Rules); err != nil {
+				log.Printf("GetScoringRules: bad rules in v%d: %v", s.Version, err)
+			}
+			sets = append(sets, s)
+		}
+
+		json.NewEncoder(w).Encode(sets)
+	}
+}
+
+// CreateScoringRules stores a new version of the rules. It takes effect at
+// effective_from, or immediately when that is left out; versions can't be
+// back-dated, since score changes already priced keep their points.
+func CreateScoringRules(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			EffectiveFrom *time.Time    `json:"effective_from"`
+			Rules         *ScoringRules `json:"rules"`
+			Note          string        `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Rules == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.Rules.Validate(); err != nil {
+			http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		effectiveFrom := time.Now()
+		if req.EffectiveFrom != nil {
+			if req.EffectiveFrom.Before(effectiveFrom.Add(-time.Minute)) {
+				http.Error(w, "effective_from must not be in the past", http.StatusBadRequest)
+				return
+			}
+			effectiveFrom = *req.EffectiveFrom
+		}
+
+		raw, err := json.Marshal(req.Rules)
+		if err != nil {
+			http.Error(w, "Invalid rules", http.StatusBadRequest)
+			return
+		}
+
+		s := scoringRuleSet{EffectiveFrom: effectiveFrom, Rules: req.Rules, Note: req.Note}
+		err = db.QueryRow(`
+			INSERT INTO scoring_rule_sets (version, effective_from, rules, note)
+			SELECT COALESCE(MAX(version), 0) + 1, $1, $2, $3 FROM scoring_rule_sets
+			RETURNING version, created_at`,
+			effectiveFrom, string(raw), req.Note).Scan(&s.Version, &s.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to save scoring rules", http.StatusInternalServerError)
+			log.Println("CreateScoringRules error:", err)
+			return
+		}
+
+		log.Printf("[Scoring] Rules v%d saved, effective %s", s.Version, effectiveFrom.Format(time.RFC3339))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+	}
+}
+
+type scoringImpact struct {
+	UserID    int `json:"user_id"`
+	Current   int `json:"current_score"`
+	Projected int `json:"projected_score"`
+	Change    int `json:"change"`
+}
+
+// DryRunScoringRules shows what scores would be had the posted rules always
+// applied: every ledger entry is replayed under them, against posts as they
+// are now. Nothing is written. ?user_id= limits it to one user and ?limit=
+// caps how many of the most affected users are listed.
+func DryRunScoringRules(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rules ScoringRules
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := rules.Validate(); err != nil {
+			http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+		limit := 50
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 1000 {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		impacts, err := replayScores(db, &rules, userID)
+		if err != nil {
+			http.Error(w, "Failed to replay scores", http.StatusInternalServerError)
+			log.Println("DryRunScoringRules error:", err)
+			return
+		}
+
+		evaluated := len(impacts)
+		var affected, gained, lost int
+		for _, imp := range impacts {
+			switch {
+			case imp.Change > 0:
+				affected++
+				gained += imp.Change
+			case imp.Change < 0:
+				affected++
+				lost -= imp.Change
+			}
+		}
+
+		sort.Slice(impacts, func(i, j int) bool {
+			a, b := impacts[i].Change, impacts[j].Change
+			if a < 0 {
+				a = -a
+			}
+			if b < 0 {
+				b = -b
+			}
+			if a != b {
+				return a > b
+			}
+			return impacts[i].UserID < impacts[j].UserID
+		})
+		if len(impacts) > limit {
+			impacts = impacts[:limit]
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users_evaluated": evaluated,
+			"users_affected":  affected,
+			"points_gained":   gained,
+			"points_lost":     lost,
+			"most_affected":   impacts,
+		})
+	}
+}
+
+type replayPost struct {
+	date   time.Time
+	length int
+}
+
+// replayScores recomputes every user's score from their ledger under rules.
+func replayScores(db *sql.DB, rules *ScoringRules, userID int) ([]scoringImpact, error) {
+	postRows, err := db.Query(`
+		SELECT id, user_id, journal_date, COALESCE(char_length(text), 0)
+		FROM posts
+		WHERE $1 = 0 OR user_id = $1
+		ORDER BY user_id, journal_date`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	posts := make(map[int]replayPost)
+	datesByUser := make(map[int][]time.Time)
+	for postRows.Next() {
+		var id, owner int
+		var p replayPost
+		if err := postRows.Scan(&id, &owner, &p.date, &p.length); err != nil {
+			postRows.Close()
+			return nil, err
+		}
+		p.date = p.date.UTC()
+		posts[id] = p
+		datesByUser[owner] = append(datesByUser[owner], p.date)
+	}
+	postRows.Close()
+	if err := postRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT l.user_id, l.action, l.points, l.post_id, l.comment_id, l.journal_date,
+		       (l.created_at AT TIME ZONE COALESCE(u.timezone, 'UTC'))::date
+		FROM score_ledger l
+		JOIN users u ON u.id = l.user_id
+		WHERE $1 = 0 OR l.user_id = $1
+		ORDER BY l.user_id, l.created_at, l.id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var impacts []scoringImpact
+	var current *scoringImpact
+	var earned map[string]int
+	var held map[string]int
+
+	flush := func() {
+		if current != nil {
+			current.Change = current.Projected - current.Current
+			impacts = append(impacts, *current)
+		}
+	}
+
+	for rows.Next() {
+		var owner, points int
+		var action string
+		var postID, commentID sql.NullInt64
+		var journalDate sql.NullTime
+		var day time.Time
+		if err := rows.Scan(&owner, &action, &points, &postID, &commentID, &journalDate, &day); err != nil {
+			return nil, err
+		}
+
+		if current == nil || current.UserID != owner {
+			flush()
+			current = &scoringImpact{UserID: owner}
+			earned = make(map[string]int)
+			held = make(map[string]int)
+		}
+		current.Current += points
+
+		// The source key matches awards with their reversals, the same way
+		// awardedPoints does.
+		source := fmt.Sprintf("%s:c%d", action, commentID.Int64)
+		if postID.Valid {
+			source = fmt.Sprintf("%s:p%d", action, postID.Int64)
+		}
+
+		change := 0
+		switch {
+		case action == "opening_balance":
+			change = points
+		case action == ledgerDecay:
+			change = rules.Decay
+		case points > 0:
+			in := scoreInput{Action: ActionType(action), EarnedToday: earned[fmt.Sprintf("%s:%s", action, day.Format("2006-01-02"))]}
+			if action == string(ActionPost) && postID.Valid {
+				date := day
+				if journalDate.Valid {
+					date = journalDate.Time.UTC()
+				}
+				p := posts[int(postID.Int64)]
+				in = postScoreInput(in, datesByUser[owner], date, p.length)
+			}
+			change = rules.Price(in)
+		default:
+			change = -held[source]
+		}
+
+		if current.Projected+change < 0 {
+			change = -current.Projected
+		}
+		current.Projected += change
+
+		if action != "opening_balance" && action != ledgerDecay {
+			held[source] += change
+			if change > 0 {
+				earned[fmt.Sprintf("%s:%s", action, day.Format("2006-01-02"))] += change
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return impacts, nil
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postCursor marks the last post of a page ordered by (journal_date, id)
+// descending. It travels to clients as an opaque base64 string.
+type postCursor struct {
+	JournalDate time.Time
+	ID          int
+}
+
+func (c postCursor) encode() string {
+	raw := c.JournalDate.Format("2006-01-02") + "_" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(s string) (*postCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	datePart, idPart, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	journalDate, err := time.Parse("2006-01-02", datePart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &postCursor{JournalDate: journalDate, ID: id}, nil
+}
+
+// Snippet highlights come back from ts_headline as chr(1) and chr(2), which
+// are stripped from the post text first, so the text can be HTML-escaped
+// before the <mark> tags go in.
+const (
+	snippetStartSel = "\x01"
+	snippetStopSel  = "\x02"
+)
+
+var snippetMarker = strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>")
+
+// escapeSnippet HTML-escapes a ts_headline snippet and turns its highlight
+// markers into <mark> tags, so the post text can never inject markup.
+func escapeSnippet(s string) string {
+	return snippetMarker.Replace(html.EscapeString(s))
+}
+
+func SearchPosts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticatedUserID(db, r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Search query 'q' parameter is required", http.StatusBadRequest)
+			return
+		}
+		if runes := []rune(query); len(runes) > 200 {
+			query = string(runes[:200])
+		}
+
+		// By default only the caller's own journal is searched; scope=visible
+		// widens it to every post the caller could see in their feed.
+		scope := r.URL.Query().Get("scope")
+		if scope == "" {
+			scope = "own"
+		}
+		if scope != "own" && scope != "visible" {
+			http.Error(w, "scope must be 'own' or 'visible'", http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var templateID *int
+		if s := r.URL.Query().Get("template_id"); s != "" {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, "Invalid template_id", http.StatusBadRequest)
+				return
+			}
+			templateID = &id
+		}
+
+		limit := 20
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 50 {
+				http.Error(w, "limit must be between 1 and 50", http.StatusBadRequest)
+				return
+			}
+		}
+
+		cursor, err := decodePostCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+
+		var cursorDate *time.Time
+		var cursorID *int
+		if cursor != nil {
+			cursorDate = &cursor.JournalDate
+			cursorID = &cursor.ID
+		}
+
+		authorFilter := "p.user_id = $1"
+		if scope == "visible" {
+			authorFilter = "p.user_id IN " + visibleAuthorsSQL("$1")
+		}
+
+		rows, err := db.Query(`
+			WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+			SELECT
+				p.id,
+				p.user_id,
+				p.template_id,
+				p.text,
+				COALESCE(p.photo_path, '') AS photo_path,
+				p.created_at,
+				p.journal_date,
+				u.username,
+				u.display_name,
+				ts_headline('english', translate(p.text, chr(1) || chr(2), ''), q.query,
+					'StartSel="' || chr(1) || '", StopSel="' || chr(2) || '", MaxWords=25, MinWords=10, MaxFragments=2') AS snippet,
+				ts_rank(p.search_vector, q.query) AS rank
+			FROM posts p
+			JOIN users u ON p.user_id = u.id
+			CROSS JOIN q
+			WHERE p.search_vector @@ q.query
+			  AND `+authorFilter+`
+			  AND ($3::date IS NULL OR p.journal_date >= $3)
+			  AND ($4::date IS NULL OR p.journal_date <= $4)
+			  AND ($5::int IS NULL OR p.template_id = $5)
+			  AND ($6::date IS NULL OR (p.journal_date, p.id) < ($6::date, $7::int))
+			ORDER BY p.journal_date DESC, p.id DESC
+			LIMIT $8`,
+			userID, query, from, to, templateID, cursorDate, cursorID, limit+1)
+		if err != nil {
+			http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+			log.Println("SearchPosts query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		type searchResult struct {
+			ID          int     `json:"id"`
+			UserID      int     `json:"user_id"`
+			TemplateID  int     `json:"template_id"`
+			Text        string  `json:"text"`
+			PhotoPath   string  `json:"photo_path"`
+			CreatedAt   string  `json:"created_at"`
+			JournalDate string  `json:"journal_date"`
+			Username    string  `json:"username"`
+			DisplayName string  `json:"display_name"`
+			Snippet     string  `json:"snippet"`
+			Rank        float64 `json:"rank"`
+		}
+
+		results := []searchResult{}
+		var lastCursor postCursor
+		hasMore := false
+		for rows.Next() {
+			var res searchResult
+			var createdAt, journalDate time.Time
+			if err := rows.Scan(&res.ID, &res.UserID, &res.TemplateID, &res.Text,
+				&res.PhotoPath, &createdAt, &journalDate, &res.Username,
+				&res.DisplayName, &res.Snippet, &res.Rank); err != nil {
+				http.Error(w, "Error scanning search results", http.StatusInternalServerError)
+				log.Println("SearchPosts scan error:", err)
+				return
+			}
+
+			// One extra row is fetched only to learn whether another page exists.
+			if len(results) == limit {
+				hasMore = true
+				break
+			}
+
+			res.Snippet = escapeSnippet(res.Snippet)
+			res.CreatedAt = createdAt.Format(time.RFC3339)
+			res.JournalDate = journalDate.Format("2006-01-02")
+			results = append(results, res)
+			lastCursor = postCursor{JournalDate: journalDate, ID: res.ID}
+		}
+
+		var nextCursor string
+		if hasMore {
+			nextCursor = lastCursor.encode()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results":     results,
+			"next_cursor": nextCursor,
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// streakFreezeEvery posted days in a row earn one streak freeze.
+	streakFreezeEvery = 7
+	// maxStreakFreezes is how many unused freezes a user can hold.
+	maxStreakFreezes = 2
+)
+
+// Streak is a user's run of consecutive journal days with a post. A missed
+// day is covered automatically while the user holds a streak freeze; covered
+// days keep the streak going but don't add to it.
+type Streak struct {
+	UserID        int     `json:"user_id"`
+	CurrentStreak int     `json:"current_streak"`
+	LongestStreak int     `json:"longest_streak"`
+	LastPostDate  *string `json:"last_post_date,omitempty"`
+	PostedToday   bool    `json:"posted_today"`
+	// FreezesAvailable are the freezes left after covering FreezesPending.
+	FreezesAvailable int `json:"freezes_available"`
+	// FreezesPending are missed days since the last post that a freeze will
+	// cover once the user posts again.
+	FreezesPending int `json:"freezes_pending"`
+	// FreezesUsed are the missed days covered within the current streak.
+	FreezesUsed int `json:"freezes_used"`
+}
+
+// streakState is what the streaks row caches as of the user's last post.
+type streakState struct {
+	count        int
+	longest      int
+	lastPostDate time.Time
+	freezes      int
+	freezesUsed  int
+}
+
+// walkStreak replays a user's journal dates, sorted ascending, spending
+// freezes on gaps they can cover and earning one every streakFreezeEvery
+// posted days of a streak.
+func walkStreak(dates []time.Time) streakState {
+	var s streakState
+	for _, d := range dates {
+		switch gap := daysBetween(s.lastPostDate, d) - 1; {
+		case s.lastPostDate.IsZero():
+			s.count = 1
+		case gap < 0:
+			continue
+		case gap == 0:
+			s.count++
+		case gap <= s.freezes:
+			s.freezes -= gap
+			s.freezesUsed += gap
+			s.count++
+		default:
+			s.count = 1
+			s.freezesUsed = 0
+		}
+
+		if s.count%streakFreezeEvery == 0 && s.freezes < maxStreakFreezes {
+			s.freezes++
+		}
+		if s.count > s.longest {
+			s.longest = s.count
+		}
+		s.lastPostDate = d
+	}
+	return s
+}
+
+// daysBetween counts whole days from a to b, both journal dates at UTC
+// midnight.
+func daysBetween(a, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// asOf turns the cached state into the streak as the user sees it on their
+// journal day today: still alive if the days missed since the last post can
+// all be covered by freezes, otherwise broken.
+func (s streakState) asOf(userID int, today time.Time) Streak {
+	st := Streak{
+		UserID:           userID,
+		LongestStreak:    s.longest,
+		FreezesAvailable: s.freezes,
+	}
+	if s.lastPostDate.IsZero() {
+		return st
+	}
+
+	last := s.lastPostDate.Format("2006-01-02")
+	st.LastPostDate = &last
+
+	missed := daysBetween(s.lastPostDate, today) - 1
+	switch {
+	case missed < 0:
+		st.PostedToday = true
+		fallthrough
+	case missed == 0:
+		st.CurrentStreak = s.count
+		st.FreezesUsed = s.freezesUsed
+	case missed <= s.freezes:
+		st.CurrentStreak = s.count
+		st.FreezesUsed = s.freezesUsed
+		st.FreezesPending = missed
+		st.FreezesAvailable -= missed
+	}
+	return st
+}
+
+// rebuildStreak recomputes a user's streak from their posts and stores it.
+// CreatePost and DeletePost call it in their transaction, so the streak
+// always matches the posts that exist.
+func rebuildStreak(tx *sql.Tx, userID int) (streakState, error) {
+	// Lock the row first so concurrent posts rebuild one after the other.
+	_, err := tx.Exec(`
+		INSERT INTO streaks (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO NOTHING`,
+		userID)
+	if err != nil {
+		return streakState{}, err
+	}
+	if _, err := tx.Exec(`SELECT 1 FROM streaks WHERE user_id = $1 FOR UPDATE`, userID); err != nil {
+		return streakState{}, err
+	}
+
+	rows, err := tx.Query(`SELECT journal_date FROM posts WHERE user_id = $1 ORDER BY journal_date`, userID)
+	if err != nil {
+		return streakState{}, err
+	}
+	var dates []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			rows.Close()
+			return streakState{}, err
+		}
+		dates = append(dates, d.UTC())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return streakState{}, err
+	}
+
+	s := walkStreak(dates)
+
+	var lastPostDate, startedAt interface{}
+	if !s.lastPostDate.IsZero() {
+		lastPostDate = s.lastPostDate
+		startedAt = s.lastPostDate.AddDate(0, 0, -(s.count - 1 + s.freezesUsed))
+	}
+	_, err = tx.Exec(`
+		UPDATE streaks
+		SET streak_count = $2,
+		    longest_streak = $3,
+		    last_post_date = $4,
+		    freezes_available = $5,
+		    freezes_used = $6,
+		    started_at = COALESCE($7, NOW()),
+		    updated_at = NOW()
+		WHERE user_id = $1`,
+		userID, s.count, s.longest, lastPostDate, s.freezes, s.freezesUsed, startedAt)
+	if err != nil {
+		return streakState{}, err
+	}
+	return s, nil
+}
+
+// buildStreak rebuilds a user's streak in a transaction of its own, for
+// readers that find no streaks row: users who haven't posted since streaks
+// were tracked have none until then.
+func buildStreak(db *sql.DB, userID int) (streakState, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return streakState{}, err
+	}
+	defer tx.Rollback()
+
+	s, err := rebuildStreak(tx, userID)
+	if err != nil {
+		return streakState{}, err
+	}
+	return s, tx.Commit()
+}
+
+// loadStreak returns a user's streak on their journal day today. Users who
+// haven't posted since streaks were tracked get theirs built on first read.
+func loadStreak(db *sql.DB, userID int, timezone string) (Streak, error) {
+	var s streakState
+	var lastPostDate sql.NullTime
+	err := db.QueryRow(`
+		SELECT streak_count, longest_streak, last_post_date, freezes_available, freezes_used
+		FROM streaks
+		WHERE user_id = $1`,
+		userID).Scan(&s.count, &s.longest, &lastPostDate, &s.freezes, &s.freezesUsed)
+	if err == sql.ErrNoRows {
+		if s, err = buildStreak(db, userID); err != nil {
+			return Streak{}, err
+		}
+	} else if err != nil {
+		return Streak{}, err
+	} else if lastPostDate.Valid {
+		s.lastPostDate = lastPostDate.Time.UTC()
+	}
+
+	today, err := ComputeJournalDate(time.Now().UTC(), timezone)
+	if err != nil {
+		today, _ = ComputeJournalDate(time.Now().UTC(), "UTC")
+	}
+	return s.asOf(userID, today), nil
+}
+
+func GetUserStreak(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var timezone string
+		err = db.QueryRow(`SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = $1`, userID).Scan(&timezone)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch streak", http.StatusInternalServerError)
+			log.Println("GetUserStreak user error:", err)
+			return
+		}
+
+		streak, err := loadStreak(db, userID, timezone)
+		if err != nil {
+			http.Error(w, "Failed to fetch streak", http.StatusInternalServerError)
+			log.Println("GetUserStreak error:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streak)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]{1,50})`)
+
+func extractHashtags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// syncPostTags replaces the stored hashtags of a post with the ones currently
+// in its text.
+func syncPostTags(q queryer, postID, userID int, journalDate time.Time, text string) error {
+	// Never nil: pq.Array(nil) is NULL, and "!= ALL(NULL)" would keep every
+	// old tag.
+	tags := extractHashtags(text)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	_, err := q.Exec(`
+		DELETE FROM post_tags
+		WHERE post_id = $1 AND tag != ALL($2)`,
+		postID, pq.Array(tags))
+	if err != nil {
+		return fmt.Errorf("failed to clear old tags: %w", err)
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO post_tags (post_id, user_id, tag, journal_date)
+		SELECT $1, $2, UNNEST($3::text[]), $4
+		ON CONFLICT (post_id, tag) DO NOTHING`,
+		postID, userID, pq.Array(tags), journalDate)
+	if err != nil {
+		return fmt.Errorf("failed to store tags: %w", err)
+	}
+
+	return nil
+}
+
+func GetUserTags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["userId"])
+		if err != nil {
+			http.Error(w, "Invalid userId", http.StatusBadRequest)
+			return
+		}
+
+		viewerID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+
+		visible, err := canViewPostsOf(db, viewerID, userID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Println("GetUserTags visibility error:", err)
+			return
+		}
+		if !visible {
+			http.Error(w, "You cannot view this user's tags", http.StatusForbidden)
+			return
+		}
+
+		// The optional from/to range lets clients build a tag cloud over time.
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT tag, COUNT(*) AS post_count, MAX(journal_date) AS last_used
+			FROM post_tags
+			WHERE user_id = $1
+			  AND ($2::date IS NULL OR journal_date >= $2)
+			  AND ($3::date IS NULL OR journal_date <= $3)
+			GROUP BY tag
+			ORDER BY post_count DESC, last_used DESC, tag`,
+			userID, from, to)
+		if err != nil {
+			http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+			log.Println("GetUserTags query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		type tagCount struct {
+			Tag      string `json:"tag"`
+			Count    int    `json:"count"`
+			LastUsed string `json:"last_used"`
+		}
+
+		tags := []tagCount{}
+		for rows.Next() {
+			var t tagCount
+			var lastUsed time.Time
+			if err := rows.Scan(&t.Tag, &t.Count, &lastUsed); err != nil {
+				http.Error(w, "Error scanning tags", http.StatusInternalServerError)
+				log.Println("GetUserTags scan error:", err)
+				return
+			}
+			t.LastUsed = lastUsed.Format("2006-01-02")
+			tags = append(tags, t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tags)
+	}
+}
+
+func GetTagPosts(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		tag := strings.ToLower(strings.TrimPrefix(vars["tag"], "#"))
+		if tag == "" {
+			http.Error(w, "Tag is required", http.StatusBadRequest)
+			return
+		}
+
+		viewerID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT
+				p.id,
+				p.user_id,
+				p.template_id,
+				p.text,
+				COALESCE(p.photo_path, '') AS photo_path,
+				p.created_at,
+				p.journal_date,
+				u.username,
+				u.display_name,
+				COALESCE((SELECT COUNT(*) FROM comments WHERE post_id = p.id), 0) AS comment_count,
+				COALESCE((SELECT COUNT(*) FROM reactions WHERE post_id = p.id), 0) AS total_reactions,
+				(SELECT reaction_type FROM reactions WHERE post_id = p.id AND user_id = $1) AS user_reaction
+			FROM post_tags pt
+			JOIN posts p ON p.id = pt.post_id
+			JOIN users u ON p.user_id = u.id
+			WHERE pt.tag = $2
+			  AND p.user_id IN `+visibleAuthorsSQL("$1")+`
+			  AND p.user_id NOT IN (SELECT muted_id FROM user_mutes WHERE muter_id = $1)
+			ORDER BY p.journal_date DESC, p.created_at DESC
+			LIMIT 50`,
+			viewerID, tag)
+		if err != nil {
+			http.Error(w, "Failed to fetch tag posts", http.StatusInternalServerError)
+			log.Println("GetTagPosts query error:", err)
+			return
+		}
+		defer rows.Close()
+
+		posts := []map[string]interface{}{}
+		for rows.Next() {
+			var (
+				id, userID, templateID  int
+				text, photoPath         string
+				createdAt, journalDate  time.Time
+				username, displayName   string
+				commentCount, reactions int
+				userReaction            sql.NullString
+			)
+			if err := rows.Scan(&id, &userID, &templateID, &text, &photoPath,
+				&createdAt, &journalDate, &username, &displayName,
+				&commentCount, &reactions, &userReaction); err != nil {
+				http.Error(w, "Error scanning tag posts", http.StatusInternalServerError)
+				log.Println("GetTagPosts scan error:", err)
+				return
+			}
+
+			var reaction interface{} = nil
+			if userReaction.Valid {
+				reaction = userReaction.String
+			}
+
+			posts = append(posts, map[string]interface{}{
+				"id":              id,
+				"user_id":         userID,
+				"template_id":     templateID,
+				"text":            text,
+				"photo_path":      photoPath,
+				"created_at":      createdAt.Format(time.RFC3339),
+				"journal_date":    journalDate.Format("2006-01-02"),
+				"username":        username,
+				"display_name":    displayName,
+				"comment_count":   commentCount,
+				"total_reactions": reactions,
+				"user_reaction":   reaction,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(posts)
+	}
+}
+
+// parseDateRange reads the optional from/to query parameters (YYYY-MM-DD).
+// Missing values come back as nil so they can be passed straight to SQL.
+func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if s := r.URL.Query().Get("from"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid from date, expected YYYY-MM-DD")
+		}
+		from = &t
+	}
+
+	if s := r.URL.Query().Get("to"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid to date, expected YYYY-MM-DD")
+		}
+		to = &t
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"database/sql"
+)
+
+// visibleAuthorsSQL returns a subquery listing the users whose posts the viewer
+// bound to param can see: themselves and anyone they share an accepted follow
+// with, in either direction. This is the rule GetUserFeed uses.
+func visibleAuthorsSQL(param string) string {
+	return `(
+		SELECT ` + param + `::int
+		UNION
+		SELECT following_id FROM followers
+		WHERE follower_id = ` + param + ` AND status = 'accepted'
+		UNION
+		SELECT follower_id FROM followers
+		WHERE following_id = ` + param + ` AND status = 'accepted'
+	)`
+}
+
+func canViewPostsOf(db *sql.DB, viewerID, ownerID int) (bool, error) {
+	if viewerID == ownerID {
+		return true, nil
+	}
+
+	var visible bool
+	err := db.QueryRow(`
+		SELECT $2::int IN `+visibleAuthorsSQL("$1"),
+		viewerID, ownerID).Scan(&visible)
+	if err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
+// blockedUsersSQL returns a subquery listing every user with a block in either
+// direction with the user bound to param.
+func blockedUsersSQL(param string) string {
+	return `(
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = ` + param + `
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = ` + param + `
+	)`
+}
+
+func isBlockedEitherWay(q queryer, userA, userB int) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2)
+			   OR (blocker_id = $2 AND blocked_id = $1)
+		)`,
+		userA, userB).Scan(&blocked)
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
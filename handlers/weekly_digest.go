@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"masterboxer.com/project-micro-journal/services"
+)
+
+const digestType = "weekly_digest"
+
+// digestConnectionLimit caps how many active connections a digest lists.
+const digestConnectionLimit = 5
+
+type weeklyDigest struct {
+	DisplayName   string
+	WeekStart     time.Time
+	WeekEnd       time.Time // last day of the week, inclusive
+	PostCount     int
+	ReactionCount int
+	CommentCount  int
+	Score         int
+	// ScoreChange is only meaningful when HasScoreChange is set, i.e. the
+	// user also got last week's digest.
+	ScoreChange         int
+	HasScoreChange      bool
+	ConnectionPostCount int
+	ActiveConnections   []digestConnection
+	UnsubscribeURL      string
+}
+
+type digestConnection struct {
+	DisplayName string
+	PostCount   int
+}
+
+// digestWeekStart returns the Monday (UTC) that starts the last full week
+// before now.
+func digestWeekStart(now time.Time) time.Time {
+	now = now.UTC()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	thisMonday := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	return thisMonday.AddDate(0, 0, -7)
+}
+
+// SendWeeklyDigests queues, for every user with a verified address who turned
+// the digest on, an email summarizing last week. Each (user, week) is claimed
+// in digest_sends, so reruns of the job skip users who already got this
+// week's digest. Once ctx is done it stops, and the next run picks up the
+// users not yet claimed.
+func SendWeeklyDigests(ctx context.Context, db *sql.DB, mailSvc *services.MailService) error {
+	weekStart := digestWeekStart(time.Now())
+	weekEnd := weekStart.AddDate(0, 0, 7)
+	log.Printf("[WeeklyDigest] Job started for week of %s", weekStart.Format("2006-01-02"))
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, u.email, u.locale
+		FROM users u
+		WHERE u.email_verified
+		  AND EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = u.id AND p.type = $1 AND p.email
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM digest_sends d
+			WHERE d.user_id = u.id AND d.week_start = $2
+		  )`,
+		digestType, weekStart)
+	if err != nil {
+		return fmt.Errorf("failed to fetch recipients: %w", err)
+	}
+
+	type recipient struct {
+		userID int
+		email  string
+		locale string
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.userID, &r.email, &r.locale); err != nil {
+			log.Printf("[WeeklyDigest] Scan error: %v", err)
+			continue
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+
+	var queued int
+	for _, r := range recipients {
+		if err := ctx.Err(); err != nil {
+			log.Printf("[WeeklyDigest] Job stopped after queueing %d digests", queued)
+			return err
+		}
+
+		digest, err := buildWeeklyDigest(db, r.userID, weekStart, weekEnd)
+		if err != nil {
+			log.Printf("[WeeklyDigest] Failed to build digest for user %d: %v", r.userID, err)
+			continue
+		}
+
+		if err := queueWeeklyDigest(db, mailSvc, r.userID, r.email, r.locale, weekStart, digest); err != nil {
+			log.Printf("[WeeklyDigest] Failed to queue digest for user %d: %v", r.userID, err)
+			continue
+		}
+		queued++
+	}
+
+	log.Printf("[WeeklyDigest] Job finished | %d recipients, %d queued", len(recipients), queued)
+	return nil
+}
+
+// queueWeeklyDigest claims the user's digest for the week and queues it in
+// one transaction, so the claim holds exactly when the mail is queued.
+func queueWeeklyDigest(db *sql.DB, mailSvc *services.MailService, userID int, email, locale string, weekStart time.Time, digest *weeklyDigest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO digest_sends (user_id, week_start, score)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, week_start) DO NOTHING`,
+		userID, weekStart, digest.Score)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	err = queueMail(tx, mailSvc, "", services.TemplatedMail{
+		To:             email,
+		Locale:         locale,
+		Template:       "weekly-digest",
+		Data:           digest,
+		UnsubscribeURL: digest.UnsubscribeURL,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func buildWeeklyDigest(db *sql.DB, userID int, weekStart, weekEnd time.Time) (*weeklyDigest, error) {
+	digest := &weeklyDigest{
+		WeekStart:      weekStart,
+		WeekEnd:        weekEnd.AddDate(0, 0, -1),
+		UnsubscribeURL: unsubscribeURL(userID, digestType),
+	}
+
+	err := db.QueryRow(`
+		SELECT u.display_name,
+		       (SELECT COUNT(*) FROM posts
+		        WHERE user_id = u.id AND journal_date >= $2::date AND journal_date < $3::date),
+		       (SELECT COUNT(*) FROM reactions r
+		        JOIN posts p ON p.id = r.post_id
+		        WHERE p.user_id = u.id AND r.user_id != u.id
+		          AND r.created_at >= $2 AND r.created_at < $3),
+		       (SELECT COUNT(*) FROM comments c
+		        JOIN posts p ON p.id = c.post_id
+		        WHERE p.user_id = u.id AND c.user_id != u.id
+		          AND c.created_at >= $2 AND c.created_at < $3),
+		       COALESCE((SELECT score FROM reflecto_scores WHERE user_id = u.id), 0)
+		FROM users u
+		WHERE u.id = $1`,
+		userID, weekStart, weekEnd,
+	).Scan(&digest.DisplayName, &digest.PostCount, &digest.ReactionCount, &digest.CommentCount, &digest.Score)
+	if err != nil {
+		return nil, err
+	}
+
+	// The score a week ago is whatever the previous digest recorded.
+	var previousScore int
+	err = db.QueryRow(`
+		SELECT score FROM digest_sends
+		WHERE user_id = $1 AND week_start = $2`,
+		userID, weekStart.AddDate(0, 0, -7)).Scan(&previousScore)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, err
+	default:
+		digest.ScoreChange = digest.Score - previousScore
+		digest.HasScoreChange = true
+	}
+
+	rows, err := db.Query(`
+		SELECT u.display_name, COUNT(*) AS post_count
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id IN (
+			SELECT following_id FROM followers
+			WHERE follower_id = $1 AND status = 'accepted'
+		  )
+		  AND p.user_id NOT IN `+blockedUsersSQL("$1")+`
+		  AND p.journal_date >= $2::date AND p.journal_date < $3::date
+		GROUP BY u.id, u.display_name
+		ORDER BY post_count DESC, u.display_name`,
+		userID, weekStart, weekEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c digestConnection
+		if err := rows.Scan(&c.DisplayName, &c.PostCount); err != nil {
+			return nil, err
+		}
+		digest.ConnectionPostCount += c.PostCount
+		if len(digest.ActiveConnections) < digestConnectionLimit {
+			digest.ActiveConnections = append(digest.ActiveConnections, c)
+		}
+	}
+
+	return digest, rows.Err()
+}
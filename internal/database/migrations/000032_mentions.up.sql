@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    id                SERIAL PRIMARY KEY,
+    post_id           INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id        INT REFERENCES comments(id) ON DELETE CASCADE,
+    mentioner_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mentioned_user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX uniq_mentions_post_user
+ON mentions(post_id, mentioned_user_id)
+WHERE comment_id IS NULL;
+
+CREATE UNIQUE INDEX uniq_mentions_comment_user
+ON mentions(comment_id, mentioned_user_id)
+WHERE comment_id IS NOT NULL;
+
+CREATE INDEX idx_mentions_mentioned_user_id ON mentions(mentioned_user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id      INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag          VARCHAR(50) NOT NULL,
+    journal_date DATE NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, tag)
+);
+
+CREATE INDEX idx_post_tags_user_tag ON post_tags(user_id, tag);
+CREATE INDEX idx_post_tags_tag_journal_date ON post_tags(tag, journal_date DESC);
+
+INSERT INTO post_tags (post_id, user_id, tag, journal_date)
+SELECT DISTINCT p.id, p.user_id, LOWER(m[1]), p.journal_date
+FROM posts p,
+     regexp_matches(p.text, '(?:^|[^[:alnum:]_&#])#([[:alnum:]_]{1,50})', 'g') AS m
+ON CONFLICT DO NOTHING;
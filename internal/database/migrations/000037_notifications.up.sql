@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id    INT REFERENCES users(id) ON DELETE CASCADE,
+    type        VARCHAR(50) NOT NULL,
+    target_type VARCHAR(50),
+    target_id   INT,
+    title       TEXT NOT NULL,
+    body        TEXT NOT NULL DEFAULT '',
+    payload     JSONB NOT NULL DEFAULT '{}',
+    read_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notifications_user_id_id ON notifications(user_id, id DESC);
+CREATE INDEX idx_notifications_user_unread ON notifications(user_id) WHERE read_at IS NULL;
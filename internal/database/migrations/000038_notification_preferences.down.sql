@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS deferred_pushes;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS quiet_hours_end,
+DROP COLUMN IF EXISTS quiet_hours_start;
+
+DROP TABLE IF EXISTS notification_preferences;
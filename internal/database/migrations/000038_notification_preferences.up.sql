@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type       VARCHAR(50) NOT NULL,
+    push       BOOLEAN NOT NULL DEFAULT TRUE,
+    email      BOOLEAN NOT NULL DEFAULT FALSE,
+    in_app     BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, type)
+);
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS quiet_hours_start TIME,
+ADD COLUMN IF NOT EXISTS quiet_hours_end TIME;
+
+CREATE TABLE IF NOT EXISTS deferred_pushes (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type          VARCHAR(50) NOT NULL,
+    title         TEXT NOT NULL,
+    body          TEXT NOT NULL DEFAULT '',
+    payload       JSONB NOT NULL DEFAULT '{}',
+    deliver_after TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_deferred_pushes_deliver_after ON deferred_pushes(deliver_after);
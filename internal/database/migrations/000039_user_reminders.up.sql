@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_reminders (
+    user_id       INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reminder_type VARCHAR(50) NOT NULL,
+    local_time    TIME NOT NULL,
+    enabled       BOOLEAN NOT NULL DEFAULT TRUE,
+    last_sent_at  TIMESTAMPTZ,
+    next_due_at   TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, reminder_type)
+);
+
+CREATE INDEX idx_user_reminders_due ON user_reminders(reminder_type, next_due_at) WHERE enabled;
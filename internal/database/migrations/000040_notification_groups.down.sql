@@ -0,0 +1,11 @@
+ALTER TABLE deferred_pushes
+DROP COLUMN IF EXISTS collapse_key;
+
+DROP INDEX IF EXISTS idx_notifications_open_groups;
+DROP INDEX IF EXISTS idx_notifications_user_updated;
+
+ALTER TABLE notifications
+DROP COLUMN IF EXISTS updated_at,
+DROP COLUMN IF EXISTS actor_count,
+DROP COLUMN IF EXISTS actor_ids,
+DROP COLUMN IF EXISTS group_key;
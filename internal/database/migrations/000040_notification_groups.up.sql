@@ -0,0 +1,17 @@
+ALTER TABLE notifications
+ADD COLUMN IF NOT EXISTS group_key VARCHAR(200),
+ADD COLUMN IF NOT EXISTS actor_ids INT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS actor_count INT NOT NULL DEFAULT 1,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE notifications
+SET actor_ids = CASE WHEN actor_id IS NULL THEN '{}' ELSE ARRAY[actor_id] END,
+    actor_count = CASE WHEN actor_id IS NULL THEN 0 ELSE 1 END,
+    updated_at = created_at;
+
+CREATE INDEX idx_notifications_user_updated ON notifications(user_id, updated_at DESC, id DESC);
+CREATE INDEX idx_notifications_open_groups ON notifications(user_id, group_key)
+    WHERE group_key IS NOT NULL AND read_at IS NULL;
+
+ALTER TABLE deferred_pushes
+ADD COLUMN IF NOT EXISTS collapse_key VARCHAR(200);
@@ -0,0 +1,4 @@
+DELETE FROM reflecto_score_events WHERE action_type = 'post';
+
+DROP TABLE IF EXISTS notification_receipts;
+DROP TABLE IF EXISTS outbox_events;
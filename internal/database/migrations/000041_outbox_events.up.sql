@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      VARCHAR(50) NOT NULL,
+    idempotency_key VARCHAR(200) NOT NULL UNIQUE,
+    payload         JSONB NOT NULL DEFAULT '{}',
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending'
+                    CHECK (status IN ('pending', 'processing', 'done', 'dead')),
+    attempts        INT NOT NULL DEFAULT 0,
+    max_attempts    INT NOT NULL DEFAULT 8,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at    TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_outbox_events_processing ON outbox_events(locked_until) WHERE status = 'processing';
+
+-- Records which recipients an event has already notified, so a retried
+-- event doesn't notify them twice.
+CREATE TABLE IF NOT EXISTS notification_receipts (
+    dedupe_key VARCHAR(200) NOT NULL,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (dedupe_key, user_id)
+);
+
+-- Post scores are now deduplicated through reflecto_score_events like the
+-- other actions; record the posts that were already scored.
+INSERT INTO reflecto_score_events (user_id, post_id, action_type)
+SELECT user_id, id, 'post' FROM posts
+ON CONFLICT (user_id, post_id, action_type) DO NOTHING;
@@ -0,0 +1,5 @@
+DELETE FROM fcm_tokens WHERE provider <> 'fcm';
+
+ALTER TABLE fcm_tokens
+    DROP COLUMN IF EXISTS provider,
+    DROP COLUMN IF EXISTS platform;
@@ -0,0 +1,7 @@
+-- Tokens can now belong to FCM, APNs or Web Push. Existing rows all came from
+-- the FCM SDK.
+ALTER TABLE fcm_tokens
+    ADD COLUMN IF NOT EXISTS platform VARCHAR(10)
+        CHECK (platform IN ('android', 'ios', 'web')),
+    ADD COLUMN IF NOT EXISTS provider VARCHAR(10) NOT NULL DEFAULT 'fcm'
+        CHECK (provider IN ('fcm', 'apns', 'webpush'));
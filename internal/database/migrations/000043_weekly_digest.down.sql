@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS digest_sends;
+
+DELETE FROM notification_preferences WHERE type = 'weekly_digest';
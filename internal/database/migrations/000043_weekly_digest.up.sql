@@ -0,0 +1,9 @@
+-- One row per digest sent. score snapshots the user's Reflecto Score at send
+-- time so the next digest can report the change.
+CREATE TABLE IF NOT EXISTS digest_sends (
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    score      INT NOT NULL DEFAULT 0,
+    sent_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, week_start)
+);
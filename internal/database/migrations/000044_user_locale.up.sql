@@ -0,0 +1,2 @@
+-- Locale the user's emails are rendered in, e.g. 'en' or 'hi'.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'en';
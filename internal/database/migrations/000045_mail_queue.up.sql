@@ -0,0 +1,26 @@
+-- Rendered emails waiting to be sent, and a record of those that were.
+-- Bounced means the receiving server rejected the message permanently;
+-- failed means it ran out of attempts on temporary errors.
+CREATE TABLE IF NOT EXISTS mail_queue (
+    id              BIGSERIAL PRIMARY KEY,
+    idempotency_key VARCHAR(200) UNIQUE,
+    template        VARCHAR(50) NOT NULL,
+    recipient       VARCHAR(320) NOT NULL,
+    subject         TEXT NOT NULL,
+    text_body       TEXT NOT NULL,
+    html_body       TEXT NOT NULL,
+    unsubscribe_url TEXT,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending'
+                    CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'bounced')),
+    attempts        INT NOT NULL DEFAULT 0,
+    max_attempts    INT NOT NULL DEFAULT 8,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX idx_mail_queue_pending ON mail_queue(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_mail_queue_sending ON mail_queue(locked_until) WHERE status = 'sending';
+CREATE INDEX idx_mail_queue_undelivered ON mail_queue(created_at) WHERE status IN ('failed', 'bounced');
@@ -0,0 +1,17 @@
+-- One row per scheduled run of a background job. The unique slot means each
+-- scheduled occurrence runs at most once, however many schedulers are up.
+CREATE TABLE IF NOT EXISTS job_runs (
+    id            BIGSERIAL PRIMARY KEY,
+    job_name      VARCHAR(100) NOT NULL,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'running'
+                  CHECK (status IN ('running', 'succeeded', 'failed')),
+    instance      VARCHAR(255) NOT NULL DEFAULT '',
+    error         TEXT,
+    started_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at   TIMESTAMPTZ,
+    UNIQUE (job_name, scheduled_for)
+);
+
+CREATE INDEX idx_job_runs_job_started ON job_runs(job_name, started_at DESC);
+CREATE INDEX idx_job_runs_failed ON job_runs(started_at) WHERE status = 'failed';
@@ -0,0 +1,3 @@
+ALTER TABLE reflecto_scores DROP COLUMN IF EXISTS decayed_through;
+
+DROP TABLE IF EXISTS score_decays;
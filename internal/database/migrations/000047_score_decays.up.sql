@@ -0,0 +1,15 @@
+-- One row per journal day a user was decayed for, so rerunning the decay job
+-- never takes a point twice.
+CREATE TABLE IF NOT EXISTS score_decays (
+    user_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    journal_date DATE NOT NULL,
+    points       INT NOT NULL,
+    applied_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, journal_date)
+);
+
+-- The last journal day decay has been evaluated for. Days after it and up to
+-- the user's last finished journal day are still owed, which is how the job
+-- catches up after downtime. Decay starts from the day this ships.
+ALTER TABLE reflecto_scores
+    ADD COLUMN IF NOT EXISTS decayed_through DATE NOT NULL DEFAULT ((NOW() AT TIME ZONE 'UTC')::date - 1);
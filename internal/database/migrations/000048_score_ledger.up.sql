@@ -0,0 +1,23 @@
+-- Append-only history of every change to a Reflecto score. points is the
+-- change actually applied after the zero floor, so a user's score is always
+-- the sum of their rows. Sources aren't foreign keys: the ledger outlives
+-- deleted posts and comments.
+CREATE TABLE IF NOT EXISTS score_ledger (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action       VARCHAR(20) NOT NULL
+                 CHECK (action IN ('opening_balance', 'post', 'comment', 'like', 'reaction', 'decay')),
+    points       INT NOT NULL,
+    post_id      INT,
+    comment_id   INT,
+    journal_date DATE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_score_ledger_user_created ON score_ledger(user_id, created_at);
+
+-- Scores from before the ledger carry over as a single opening entry.
+INSERT INTO score_ledger (user_id, action, points, created_at)
+SELECT user_id, 'opening_balance', score, updated_at
+FROM reflecto_scores
+WHERE score <> 0;
@@ -0,0 +1,3 @@
+ALTER TABLE score_ledger DROP COLUMN IF EXISTS rule_version;
+
+DROP TABLE IF EXISTS scoring_rule_sets;
@@ -0,0 +1,19 @@
+-- Versioned scoring rules. The version with the latest effective_from that
+-- has passed prices new score changes; see handlers.ScoringRules for the
+-- shape of rules.
+CREATE TABLE IF NOT EXISTS scoring_rule_sets (
+    version        INT PRIMARY KEY,
+    effective_from TIMESTAMPTZ NOT NULL,
+    rules          JSONB NOT NULL,
+    note           TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scoring_rule_sets_effective ON scoring_rule_sets(effective_from DESC);
+
+-- Version 1 is the points that were hardcoded until now.
+INSERT INTO scoring_rule_sets (version, effective_from, rules, note)
+VALUES (1, '1970-01-01', '{"points": {"post": 5, "comment": 2, "like": 1, "reaction": 1}, "decay": -1}', 'Original fixed points')
+ON CONFLICT (version) DO NOTHING;
+
+ALTER TABLE score_ledger ADD COLUMN IF NOT EXISTS rule_version INT REFERENCES scoring_rule_sets(version);
@@ -0,0 +1,3 @@
+ALTER TABLE streaks
+    DROP COLUMN IF EXISTS freezes_used,
+    DROP COLUMN IF EXISTS freezes_available;
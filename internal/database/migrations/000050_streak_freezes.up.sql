@@ -0,0 +1,3 @@
+ALTER TABLE streaks
+    ADD COLUMN freezes_available INT NOT NULL DEFAULT 0,
+    ADD COLUMN freezes_used INT NOT NULL DEFAULT 0;
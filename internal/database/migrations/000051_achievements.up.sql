@@ -0,0 +1,10 @@
+-- Achievements a user has unlocked. The definitions live in code; a row is
+-- written once per user and achievement. notified_at stays NULL until the
+-- unlock notification has gone out.
+CREATE TABLE IF NOT EXISTS user_achievements (
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    achievement_key VARCHAR(50) NOT NULL,
+    unlocked_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notified_at     TIMESTAMPTZ,
+    PRIMARY KEY (user_id, achievement_key)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS pact_nudges;
+DROP TABLE IF EXISTS pacts;
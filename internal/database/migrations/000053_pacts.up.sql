@@ -0,0 +1,35 @@
+-- Accountability pacts between two mutual followers. The shared streak counts
+-- consecutive journal dates on which both partners posted, from started_on.
+CREATE TABLE IF NOT EXISTS pacts (
+    id               SERIAL PRIMARY KEY,
+    inviter_id       INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invitee_id       INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status           VARCHAR(20) NOT NULL DEFAULT 'pending'
+                     CHECK (status IN ('pending', 'active', 'declined', 'cancelled', 'ended')),
+    streak_count     INT NOT NULL DEFAULT 0,
+    longest_streak   INT NOT NULL DEFAULT 0,
+    last_shared_date DATE,
+    started_on       DATE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at      TIMESTAMPTZ,
+    ended_at         TIMESTAMPTZ,
+    ended_by         INT REFERENCES users(id) ON DELETE SET NULL,
+    CHECK (inviter_id <> invitee_id)
+);
+
+-- A pair can only have one pending or active pact at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_open_pact
+    ON pacts (LEAST(inviter_id, invitee_id), GREATEST(inviter_id, invitee_id))
+    WHERE status IN ('pending', 'active');
+
+CREATE INDEX IF NOT EXISTS idx_pacts_inviter ON pacts(inviter_id);
+CREATE INDEX IF NOT EXISTS idx_pacts_invitee ON pacts(invitee_id);
+
+CREATE TABLE IF NOT EXISTS pact_nudges (
+    id         SERIAL PRIMARY KEY,
+    pact_id    INT NOT NULL REFERENCES pacts(id) ON DELETE CASCADE,
+    sender_id  INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pact_nudges_pact_sender ON pact_nudges(pact_id, sender_id, created_at DESC);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS circle_comments;
+DROP TABLE IF EXISTS circle_posts;
+DROP TABLE IF EXISTS circle_invites;
+DROP TABLE IF EXISTS circle_members;
+DROP TABLE IF EXISTS circles;
@@ -0,0 +1,58 @@
+-- Circles are small invite-only groups. Nothing in a circle is visible to
+-- non-members.
+CREATE TABLE IF NOT EXISTS circles (
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(60) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    owner_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS circle_members (
+    circle_id INT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    user_id   INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role      VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (circle_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_members_user ON circle_members(user_id);
+
+-- Only a hash of the invite token is stored; the link carries the token.
+CREATE TABLE IF NOT EXISTS circle_invites (
+    id         SERIAL PRIMARY KEY,
+    circle_id  INT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    max_uses   INT,
+    uses       INT NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_invites_circle ON circle_invites(circle_id);
+
+CREATE TABLE IF NOT EXISTS circle_posts (
+    circle_id INT NOT NULL REFERENCES circles(id) ON DELETE CASCADE,
+    post_id   INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    shared_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (circle_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_posts_feed ON circle_posts(circle_id, shared_at DESC);
+CREATE INDEX IF NOT EXISTS idx_circle_posts_post ON circle_posts(post_id);
+
+-- Comments made inside a circle are only seen by its members, and go away
+-- with the share.
+CREATE TABLE IF NOT EXISTS circle_comments (
+    id         SERIAL PRIMARY KEY,
+    circle_id  INT NOT NULL,
+    post_id    INT NOT NULL,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    text       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (circle_id, post_id) REFERENCES circle_posts(circle_id, post_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_circle_comments_post ON circle_comments(circle_id, post_id, created_at);
@@ -0,0 +1,19 @@
+-- Take challenge bonuses back out of scores along with their ledger rows, so
+-- every score still equals the sum of its ledger.
+UPDATE reflecto_scores s
+SET score = s.score - c.points, updated_at = NOW()
+FROM (
+    SELECT user_id, SUM(points) AS points
+    FROM score_ledger
+    WHERE action = 'challenge'
+    GROUP BY user_id
+) c
+WHERE s.user_id = c.user_id;
+
+DELETE FROM score_ledger WHERE action = 'challenge';
+ALTER TABLE score_ledger DROP CONSTRAINT IF EXISTS score_ledger_action_check;
+ALTER TABLE score_ledger ADD CONSTRAINT score_ledger_action_check
+    CHECK (action IN ('opening_balance', 'post', 'comment', 'like', 'reaction', 'decay'));
+
+DROP TABLE IF EXISTS challenge_participants;
+DROP TABLE IF EXISTS challenges;
@@ -0,0 +1,31 @@
+-- Time-boxed community challenges: write an entry with one template on at
+-- least required_days of the journal dates from start_date to end_date.
+CREATE TABLE IF NOT EXISTS challenges (
+    id            SERIAL PRIMARY KEY,
+    title         VARCHAR(100) NOT NULL,
+    description   TEXT NOT NULL DEFAULT '',
+    template_id   INT NOT NULL REFERENCES templates(id) ON DELETE RESTRICT,
+    start_date    DATE NOT NULL,
+    end_date      DATE NOT NULL,
+    required_days INT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (end_date >= start_date),
+    CHECK (required_days BETWEEN 1 AND end_date - start_date + 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_challenges_dates ON challenges(end_date, start_date);
+
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    challenge_id INT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    PRIMARY KEY (challenge_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_challenge_participants_user ON challenge_participants(user_id);
+
+-- Completing a challenge earns a score bonus.
+ALTER TABLE score_ledger DROP CONSTRAINT IF EXISTS score_ledger_action_check;
+ALTER TABLE score_ledger ADD CONSTRAINT score_ledger_action_check
+    CHECK (action IN ('opening_balance', 'post', 'comment', 'like', 'reaction', 'decay', 'challenge'));
@@ -0,0 +1,2 @@
+DELETE FROM user_reminders WHERE reminder_type = 'memories';
+ALTER TABLE users DROP COLUMN IF EXISTS memories_opt_out;
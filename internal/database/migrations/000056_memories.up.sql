@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS memories_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
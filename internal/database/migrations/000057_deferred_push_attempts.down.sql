@@ -0,0 +1 @@
+ALTER TABLE deferred_pushes DROP COLUMN IF EXISTS attempts;
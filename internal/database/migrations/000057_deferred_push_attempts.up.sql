@@ -0,0 +1 @@
+ALTER TABLE deferred_pushes ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
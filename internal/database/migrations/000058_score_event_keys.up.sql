@@ -0,0 +1,7 @@
+-- Score changes that aren't tied to a post (challenge bonuses) are
+-- deduplicated on the outbox event that awarded them.
+CREATE TABLE IF NOT EXISTS score_event_keys (
+    event_key  TEXT PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
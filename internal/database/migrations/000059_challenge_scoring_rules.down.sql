@@ -0,0 +1,10 @@
+-- Drop challenge points from every rule set, then the version added for them
+-- unless ledger rows were priced under it (it now prices like its
+-- predecessor, so keeping it changes nothing).
+UPDATE scoring_rule_sets
+SET rules = rules #- '{points,challenge}'
+WHERE rules->'points' ? 'challenge';
+
+DELETE FROM scoring_rule_sets s
+WHERE s.note = 'Challenge completion bonus'
+  AND NOT EXISTS (SELECT 1 FROM score_ledger l WHERE l.rule_version = s.version);
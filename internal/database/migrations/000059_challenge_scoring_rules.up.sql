@@ -0,0 +1,18 @@
+-- Rule sets stored so far have no challenge points, so the bonus would price
+-- at 0. Carry the rules in effect forward as a new version with the bonus,
+-- and add it to any version scheduled for later.
+WITH current AS (
+    SELECT rules FROM scoring_rule_sets
+    WHERE effective_from <= NOW()
+    ORDER BY effective_from DESC, version DESC
+    LIMIT 1
+)
+INSERT INTO scoring_rule_sets (version, effective_from, rules, note)
+SELECT (SELECT MAX(version) FROM scoring_rule_sets) + 1, NOW(),
+       jsonb_set(rules, '{points,challenge}', '25'), 'Challenge completion bonus'
+FROM current
+WHERE NOT (rules->'points' ? 'challenge');
+
+UPDATE scoring_rule_sets
+SET rules = jsonb_set(rules, '{points,challenge}', '25')
+WHERE effective_from > NOW() AND NOT (rules->'points' ? 'challenge');
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"masterboxer.com/project-micro-journal/database"
+	"masterboxer.com/project-micro-journal/handlers"
 	"masterboxer.com/project-micro-journal/routes"
 	"masterboxer.com/project-micro-journal/services"
 )
@@ -18,19 +25,10 @@ func main() {
 	}
 	defer db.Close()
 
-	if err := services.InitFirebase("./project-micro-journal-firebase-adminsdk-fbsvc-e626a40f9b.json"); err != nil {
-		log.Printf("Warning: Firebase initialization failed: %v", err)
-	}
-
-	cfg := services.Config{
-		Host:     os.Getenv("SMTP_HOST"),
-		Port:     587,
-		Username: os.Getenv("SMTP_USER"),
-		Password: os.Getenv("SMTP_PASS"),
-		From:     os.Getenv("SMTP_FROM"),
-	}
+	push := services.NewPushSenderFromEnv(context.Background(),
+		"./project-micro-journal-firebase-adminsdk-fbsvc-e626a40f9b.json")
 
-	mailSvc, err := services.NewMailService(cfg)
+	mailSvc, err := services.NewMailService(services.ConfigFromEnv())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -42,12 +40,46 @@ func main() {
 	routes.CreatePostRoutes(db, router)
 	routes.CreateMailVerificationRoutes(db, mailSvc, router)
 	routes.CreateTemplateRoutes(db, router)
-	routes.CreateNotificationRoutes(db, router)
+	routes.CreateNotificationRoutes(db, push, router)
+	routes.CreateTagRoutes(db, router)
+	routes.CreatePactRoutes(db, router)
+	routes.CreateCircleRoutes(db, router)
+	routes.CreateChallengeRoutes(db, router)
+	routes.CreateAdminRoutes(db, router)
 
 	handler := corsMiddleware(jsonContentTypeMiddleware(router))
 
-	log.Println("Starting server on :8200...")
-	log.Fatal(http.ListenAndServe(":8200", handler))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	outboxWorkers, _ := strconv.Atoi(os.Getenv("OUTBOX_WORKERS"))
+	outbox := handlers.NewOutboxWorker(db, push, mailSvc, outboxWorkers)
+	outbox.Start(context.Background())
+
+	mailSender := handlers.NewMailSender(db, mailSvc)
+	mailSender.Start(context.Background())
+
+	srv := &http.Server{Addr: ":8200", Handler: handler}
+	go func() {
+		log.Println("Starting server on :8200...")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	// Stop taking requests first so no new events are enqueued, then let the
+	// outbox finish whatever it has already claimed. The outbox queues mail,
+	// so the mail sender stops last.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown error: %v", err)
+	}
+	outbox.Stop()
+	mailSender.Stop()
 }
 
 func jsonContentTypeMiddleware(next http.Handler) http.Handler {
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Notification struct {
+	ID         int64           `json:"id"`
+	UserID     int             `json:"user_id"`
+	ActorID    *int            `json:"actor_id,omitempty"`
+	ActorIDs   []int64         `json:"actor_ids"`
+	ActorCount int             `json:"actor_count"`
+	Type       string          `json:"type"`
+	TargetType *string         `json:"target_type,omitempty"`
+	TargetID   *int            `json:"target_id,omitempty"`
+	Title      string          `json:"title"`
+	Body       string          `json:"body"`
+	Payload    json.RawMessage `json:"payload"`
+	ReadAt     *time.Time      `json:"read_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
@@ -17,6 +17,7 @@ type User struct {
 	IsPrivate   *bool     `json:"is_private"`
 	Password    string    `json:"password,omitempty"`
 	FCMToken    string    `json:"fcm_token,omitempty"`
+	Locale      string    `json:"locale,omitempty"`
 	CreatedAt   string    `json:"created_at"`
 }
 
@@ -82,13 +83,11 @@ func (c CivilDate) String() string {
 }
 
 type UserSearchResult struct {
-	ID          int       `json:"id"`
-	Username    string    `json:"username"`
-	DisplayName string    `json:"display_name"`
-	DOB         CivilDate `json:"dob"`
-	Gender      string    `json:"gender"`
-	Email       string    `json:"email"`
-	CreatedAt   string    `json:"created_at"`
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Gender      string `json:"gender"`
+	CreatedAt   string `json:"created_at"`
 }
 
 type BuddyRequest struct {
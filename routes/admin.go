@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"database/sql"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func CreateAdminRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+
+	router.HandleFunc("/admin/mail", handlers.RequireAdmin(handlers.GetMailQueue(db))).Methods("GET")
+	router.HandleFunc("/admin/mail/stats", handlers.RequireAdmin(handlers.GetMailQueueStats(db))).Methods("GET")
+	router.HandleFunc("/admin/mail/{id}/retry", handlers.RequireAdmin(handlers.RetryMail(db))).Methods("POST")
+
+	router.HandleFunc("/admin/scoring-rules", handlers.RequireAdmin(handlers.GetScoringRules(db))).Methods("GET")
+	router.HandleFunc("/admin/scoring-rules", handlers.RequireAdmin(handlers.CreateScoringRules(db))).Methods("POST")
+	router.HandleFunc("/admin/scoring-rules/dry-run", handlers.RequireAdmin(handlers.DryRunScoringRules(db))).Methods("POST")
+
+	router.HandleFunc("/admin/challenges", handlers.RequireAdmin(handlers.CreateChallenge(db))).Methods("POST")
+	router.HandleFunc("/admin/challenges/{id}", handlers.RequireAdmin(handlers.DeleteChallenge(db))).Methods("DELETE")
+
+	return router
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"database/sql"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func CreateChallengeRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+
+	router.HandleFunc("/challenges", handlers.GetChallenges(db)).Methods("GET")
+	router.HandleFunc("/challenges/{id}", handlers.GetChallenge(db)).Methods("GET")
+	router.HandleFunc("/challenges/{id}/join", handlers.JoinChallenge(db)).Methods("POST")
+	router.HandleFunc("/challenges/{id}/join", handlers.LeaveChallenge(db)).Methods("DELETE")
+	router.HandleFunc("/challenges/{id}/participants/{userId}/progress", handlers.GetChallengeProgress(db)).Methods("GET")
+
+	return router
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"database/sql"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func CreateCircleRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+
+	router.HandleFunc("/circles", handlers.GetCircles(db)).Methods("GET")
+	router.HandleFunc("/circles", handlers.CreateCircle(db)).Methods("POST")
+	router.HandleFunc("/circles/join", handlers.JoinCircle(db)).Methods("POST")
+	router.HandleFunc("/circles/{id}", handlers.GetCircle(db)).Methods("GET")
+	router.HandleFunc("/circles/{id}", handlers.DeleteCircle(db)).Methods("DELETE")
+
+	router.HandleFunc("/circles/{id}/members/{userId}", handlers.UpdateCircleMemberRole(db)).Methods("PUT")
+	router.HandleFunc("/circles/{id}/members/{userId}", handlers.RemoveCircleMember(db)).Methods("DELETE")
+	router.HandleFunc("/circles/{id}/invites", handlers.CreateCircleInvite(db)).Methods("POST")
+	router.HandleFunc("/circles/{id}/invites/{inviteId}", handlers.RevokeCircleInvite(db)).Methods("DELETE")
+
+	router.HandleFunc("/posts/{postId}/circles", handlers.ShareToCircles(db)).Methods("POST")
+	router.HandleFunc("/circles/{id}/feed", handlers.GetCircleFeed(db)).Methods("GET")
+	router.HandleFunc("/circles/{id}/posts/{postId}", handlers.UnshareFromCircle(db)).Methods("DELETE")
+	router.HandleFunc("/circles/{id}/posts/{postId}/comments", handlers.GetCircleComments(db)).Methods("GET")
+	router.HandleFunc("/circles/{id}/posts/{postId}/comments", handlers.CreateCircleComment(db)).Methods("POST")
+	router.HandleFunc("/circles/{id}/comments/{commentId}", handlers.DeleteCircleComment(db)).Methods("DELETE")
+
+	return router
+}
@@ -5,11 +5,21 @@ import (
 
 	"github.com/gorilla/mux"
 	"masterboxer.com/project-micro-journal/handlers"
+	"masterboxer.com/project-micro-journal/services"
 )
 
-func CreateNotificationRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+func CreateNotificationRoutes(db *sql.DB, push services.PushSender, router *mux.Router) *mux.Router {
 
 	router.HandleFunc("/fcm/register-token", handlers.RegisterFCMToken(db)).Methods("POST")
+	router.HandleFunc("/push/register-token", handlers.RegisterTokenHandler(db)).Methods("POST")
+	router.HandleFunc("/push/vapid-public-key", handlers.GetVAPIDPublicKey(push)).Methods("GET")
+
+	router.HandleFunc("/notifications", handlers.GetNotifications(db)).Methods("GET")
+	router.HandleFunc("/notifications/unread-count", handlers.GetUnreadNotificationCount(db)).Methods("GET")
+	router.HandleFunc("/notifications/read-all", handlers.MarkAllNotificationsRead(db)).Methods("POST")
+	router.HandleFunc("/notifications/{id}/read", handlers.MarkNotificationRead(db)).Methods("POST")
+
+	router.HandleFunc("/email/unsubscribe", handlers.UnsubscribeEmail(db)).Methods("GET", "POST")
 
 	return router
 }
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"database/sql"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func CreatePactRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+
+	router.HandleFunc("/pacts", handlers.GetPacts(db)).Methods("GET")
+	router.HandleFunc("/pacts", handlers.CreatePact(db)).Methods("POST")
+	router.HandleFunc("/pacts/{id}", handlers.GetPact(db)).Methods("GET")
+	router.HandleFunc("/pacts/{id}", handlers.EndPact(db)).Methods("DELETE")
+	router.HandleFunc("/pacts/{id}/accept", handlers.AcceptPact(db)).Methods("POST")
+	router.HandleFunc("/pacts/{id}/decline", handlers.DeclinePact(db)).Methods("POST")
+	router.HandleFunc("/pacts/{id}/nudge", handlers.NudgePact(db)).Methods("POST")
+
+	return router
+}
@@ -9,6 +9,7 @@ import (
 
 func CreatePostRoutes(db *sql.DB, router *mux.Router) *mux.Router {
 	router.HandleFunc("/posts/today", handlers.GetTodayPostForUser(db)).Methods("GET")
+	router.HandleFunc("/posts/search", handlers.SearchPosts(db)).Methods("GET")
 	router.HandleFunc("/posts", handlers.CreatePost(db)).Methods("POST")
 	router.HandleFunc("/posts/{id}", handlers.UpdatePost(db)).Methods("PUT")
 	router.HandleFunc("/posts/user/{userId}", handlers.GetPostsByUser(db)).Methods("GET")
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"database/sql"
+
+	"github.com/gorilla/mux"
+	"masterboxer.com/project-micro-journal/handlers"
+)
+
+func CreateTagRoutes(db *sql.DB, router *mux.Router) *mux.Router {
+
+	router.HandleFunc("/users/{userId}/tags", handlers.GetUserTags(db)).Methods("GET")
+	router.HandleFunc("/tags/{tag}/posts", handlers.GetTagPosts(db)).Methods("GET")
+
+	return router
+}
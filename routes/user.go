@@ -10,6 +10,12 @@ import (
 func CreateUserRoutes(db *sql.DB, router *mux.Router) *mux.Router {
 
 	router.HandleFunc("/users/search", handlers.SearchUsers(db)).Methods("GET")
+	router.HandleFunc("/users/me/notification-settings", handlers.GetNotificationSettings(db)).Methods("GET")
+	router.HandleFunc("/users/me/notification-settings", handlers.UpdateNotificationSettings(db)).Methods("PUT")
+	router.HandleFunc("/users/me/reminders", handlers.GetReminders(db)).Methods("GET")
+	router.HandleFunc("/users/me/reminders", handlers.UpdateReminders(db)).Methods("PUT")
+	router.HandleFunc("/users/me/leaderboards", handlers.UpdateLeaderboardSettings(db)).Methods("PUT")
+	router.HandleFunc("/users/me/memories", handlers.UpdateMemorySettings(db)).Methods("PUT")
 	router.HandleFunc("/users", handlers.GetUsers(db)).Methods("GET")
 	router.HandleFunc("/users/{id}", handlers.GetUserById(db)).Methods("GET")
 	router.HandleFunc("/users/{id}", handlers.UpdateUser(db)).Methods("PUT")
@@ -33,7 +39,19 @@ func CreateUserRoutes(db *sql.DB, router *mux.Router) *mux.Router {
 	router.HandleFunc("/users/{user_id}/follow-requests/{following_id}/cancel", handlers.CancelFollowRequest(db)).Methods("DELETE")
 	router.HandleFunc("/users/{id}/privacy", handlers.UpdateUserPrivacy(db)).Methods("PUT")
 
+	router.HandleFunc("/users/{user_id}/blocks", handlers.BlockUser(db)).Methods("POST")
+	router.HandleFunc("/users/{user_id}/blocks", handlers.GetBlockedUsers(db)).Methods("GET")
+	router.HandleFunc("/users/{user_id}/blocks/{blocked_id}", handlers.UnblockUser(db)).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/mutes", handlers.MuteUser(db)).Methods("POST")
+	router.HandleFunc("/users/{user_id}/mutes", handlers.GetMutedUsers(db)).Methods("GET")
+	router.HandleFunc("/users/{user_id}/mutes/{muted_id}", handlers.UnmuteUser(db)).Methods("DELETE")
+
 	router.HandleFunc("/users/{userId}/reflecto-score", handlers.GetUserReflectoScore(db)).Methods("GET")
+	router.HandleFunc("/users/{userId}/reflecto-score/history", handlers.GetReflectoScoreHistory(db)).Methods("GET")
+	router.HandleFunc("/users/{userId}/streak", handlers.GetUserStreak(db)).Methods("GET")
+	router.HandleFunc("/users/{userId}/achievements", handlers.GetUserAchievements(db)).Methods("GET")
+	router.HandleFunc("/leaderboards", handlers.GetLeaderboard(db)).Methods("GET")
+	router.HandleFunc("/memories/today", handlers.GetTodayMemories(db)).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,63 @@
+package scheduler
+
+import "time"
+
+// Schedule decides when a job is due. Next returns the first run time
+// strictly after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+// Every runs a job at each multiple of d since the Unix epoch, so every
+// instance agrees on the run times: Every(time.Minute) runs at :00 seconds.
+func Every(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("scheduler: Every needs a positive interval")
+	}
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.UTC().Truncate(d).Add(d)
+}
+
+type daily struct {
+	hour, minute int
+}
+
+// Daily runs a job once a day at hour:minute UTC.
+func Daily(hour, minute int) Schedule {
+	return daily{hour: hour, minute: minute}
+}
+
+func (d daily) Next(t time.Time) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), d.hour, d.minute, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+type weekly struct {
+	weekday      time.Weekday
+	hour, minute int
+}
+
+// Weekly runs a job once a week on weekday at hour:minute UTC.
+func Weekly(weekday time.Weekday, hour, minute int) Schedule {
+	return weekly{weekday: weekday, hour: hour, minute: minute}
+}
+
+func (w weekly) Next(t time.Time) time.Time {
+	t = t.UTC()
+	days := (int(w.weekday) - int(t.Weekday()) + 7) % 7
+	next := time.Date(t.Year(), t.Month(), t.Day()+days, w.hour, w.minute, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
@@ -0,0 +1,213 @@
+// Package scheduler runs background jobs on fixed schedules inside a long
+// running process. Any number of schedulers may run side by side: each run
+// takes a Postgres advisory lock on its job and claims its time slot in
+// job_runs, so a scheduled occurrence runs once, on one instance.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultJobTimeout = 30 * time.Minute
+
+// Job is a unit of background work. Run should return an error only when the
+// run as a whole failed; per-user problems are better logged and skipped.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+	// Timeout bounds a single run. Zero means 30 minutes.
+	Timeout time.Duration
+}
+
+type Scheduler struct {
+	db       *sql.DB
+	instance string
+	jobs     []Job
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(db *sql.DB) *Scheduler {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	return &Scheduler{db: db, instance: fmt.Sprintf("%s/%d", instance, os.Getpid())}
+}
+
+func (s *Scheduler) Register(job Job) {
+	if job.Timeout == 0 {
+		job.Timeout = defaultJobTimeout
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+func (s *Scheduler) Jobs() []Job {
+	return append([]Job(nil), s.jobs...)
+}
+
+// Start runs every registered job on its schedule until Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, job := range s.jobs {
+		job := job
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}()
+		log.Printf("[Scheduler] %s next runs at %s", job.Name,
+			job.Schedule.Next(time.Now()).Format(time.RFC3339))
+	}
+}
+
+// Stop stops scheduling new runs, cancels the context of the ones in progress
+// and waits for them to return.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	log.Println("[Scheduler] Stopped")
+}
+
+// RunNow runs the named job once, immediately, with the same locking and
+// bookkeeping as a scheduled run.
+func (s *Scheduler) RunNow(name string) error {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			if job.Timeout == 0 {
+				job.Timeout = defaultJobTimeout
+			}
+			return s.runSlot(context.Background(), job, time.Now().UTC().Truncate(time.Second))
+		}
+	}
+	return fmt.Errorf("unknown job %q", name)
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	next := job.Schedule.Next(time.Now())
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := s.runSlot(ctx, job, next); err != nil {
+			log.Printf("[Scheduler] %s run for %s failed: %v", job.Name, next.Format(time.RFC3339), err)
+		}
+
+		// A run that overran its interval skips the slots it missed rather
+		// than firing them back to back.
+		now := time.Now()
+		if next.Before(now) {
+			next = job.Schedule.Next(now)
+		} else {
+			next = job.Schedule.Next(next)
+		}
+	}
+}
+
+// runSlot runs job for the occurrence scheduled at slot, unless another
+// instance is running the job right now or already ran that slot. The job's
+// context derives from parent; the bookkeeping around it does not, so a run
+// cut short by shutdown is still recorded.
+func (s *Scheduler) runSlot(parent context.Context, job Job, slot time.Time) error {
+	ctx := context.Background()
+
+	// Advisory locks belong to a session, so everything from lock to unlock
+	// goes through one connection.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey(job.Name)).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take lock: %w", err)
+	}
+	if !locked {
+		log.Printf("[Scheduler] %s is running on another instance, skipping", job.Name)
+		return nil
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey(job.Name))
+
+	// Holding the lock means no other run of this job is alive, so rows
+	// still marked running belong to a process that died mid-run.
+	if _, err := conn.ExecContext(ctx, `
+		UPDATE job_runs
+		SET status = 'failed', error = 'interrupted', finished_at = NOW()
+		WHERE job_name = $1 AND status = 'running'`,
+		job.Name); err != nil {
+		return fmt.Errorf("failed to close interrupted runs: %w", err)
+	}
+
+	var runID int64
+	err = conn.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job_name, scheduled_for, instance)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job_name, scheduled_for) DO NOTHING
+		RETURNING id`,
+		job.Name, slot, s.instance).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+
+	log.Printf("[Scheduler] %s started (run %d)", job.Name, runID)
+	started := time.Now()
+	runErr := s.run(parent, job)
+
+	status := "succeeded"
+	var errText sql.NullString
+	if runErr != nil {
+		status = "failed"
+		errText = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	log.Printf("[Scheduler] %s %s in %s", job.Name, status, time.Since(started).Round(time.Millisecond))
+
+	if _, err := conn.ExecContext(ctx, `
+		UPDATE job_runs
+		SET status = $2, error = $3, finished_at = NOW()
+		WHERE id = $1`,
+		runID, status, errText); err != nil {
+		return fmt.Errorf("failed to record result: %w", err)
+	}
+	return runErr
+}
+
+func (s *Scheduler) run(parent context.Context, job Job) (err error) {
+	ctx, cancel := context.WithTimeout(parent, job.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
+
+// lockKey maps a job name onto the bigint key space of advisory locks.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + name))
+	return int64(h.Sum64())
+}
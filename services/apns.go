@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	apnsProductionHost  = "https://api.push.apple.com"
+	apnsDevelopmentHost = "https://api.sandbox.push.apple.com"
+
+	// Apple rejects provider tokens older than an hour and throttles ones
+	// refreshed more often than every 20 minutes.
+	apnsTokenLifetime = 45 * time.Minute
+)
+
+type APNsConfig struct {
+	// KeyPath points at the .p8 signing key downloaded from the Apple
+	// developer portal.
+	KeyPath string
+	KeyID   string
+	TeamID  string
+	// Topic is the app's bundle ID.
+	Topic      string
+	Production bool
+}
+
+// APNsSender delivers pushes straight to Apple Push Notification service
+// using token-based authentication.
+type APNsSender struct {
+	key    *ecdsa.PrivateKey
+	keyID  string
+	teamID string
+	topic  string
+	host   string
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	tokenIat time.Time
+}
+
+func NewAPNsSender(cfg APNsConfig) (*APNsSender, error) {
+	switch {
+	case cfg.KeyID == "":
+		return nil, errMissingConfig("APNS_KEY_ID")
+	case cfg.TeamID == "":
+		return nil, errMissingConfig("APNS_TEAM_ID")
+	case cfg.Topic == "":
+		return nil, errMissingConfig("APNS_TOPIC")
+	}
+
+	pemBytes, err := os.ReadFile(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNs key: %w", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("APNs key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse APNs key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("APNs key is not an ECDSA key")
+	}
+
+	host := apnsDevelopmentHost
+	if cfg.Production {
+		host = apnsProductionHost
+	}
+
+	return &APNsSender{
+		key:    key,
+		keyID:  cfg.KeyID,
+		teamID: cfg.TeamID,
+		topic:  cfg.Topic,
+		host:   host,
+		// The default transport negotiates HTTP/2 over TLS, which APNs requires.
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *APNsSender) Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error) {
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": msg.Title,
+				"body":  msg.Body,
+			},
+			"sound": "default",
+		},
+	}
+	for k, v := range msg.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return PushReport{}, err
+	}
+
+	authToken, err := s.providerToken()
+	if err != nil {
+		return PushReport{}, fmt.Errorf("failed to sign APNs token: %w", err)
+	}
+
+	var report PushReport
+	for _, device := range devices {
+		invalid, err := s.sendOne(ctx, authToken, device.Token, body, msg.CollapseKey)
+		if err != nil {
+			log.Printf("[APNs][TOKEN ERROR] token=%s error=%v", device.Token, err)
+			report.FailureCount++
+			if invalid {
+				report.InvalidTokens = append(report.InvalidTokens, device.Token)
+			}
+			continue
+		}
+		report.SuccessCount++
+	}
+
+	log.Printf("[APNs] Send result | success=%d failure=%d", report.SuccessCount, report.FailureCount)
+	return report, nil
+}
+
+func (s *APNsSender) sendOne(ctx context.Context, authToken, deviceToken string, body []byte, collapseKey string) (invalid bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		s.host+"/3/device/"+deviceToken, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("authorization", "bearer "+authToken)
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", "alert")
+	if collapseKey != "" {
+		req.Header.Set("apns-collapse-id", collapseKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	json.Unmarshal(raw, &apnsErr)
+
+	invalid = resp.StatusCode == http.StatusGone ||
+		apnsErr.Reason == "BadDeviceToken" ||
+		apnsErr.Reason == "Unregistered" ||
+		apnsErr.Reason == "DeviceTokenNotForTopic"
+	return invalid, fmt.Errorf("APNs returned %d: %s", resp.StatusCode, apnsErr.Reason)
+}
+
+// providerToken returns the signed JWT APNs expects, reusing it until it
+// nears expiry.
+func (s *APNsSender) providerToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Since(s.tokenIat) < apnsTokenLifetime {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": s.teamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = s.keyID
+
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = signed
+	s.tokenIat = now
+	return signed, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// DefaultLocale is used when an email has no variant for the user's locale.
+const DefaultLocale = "en"
+
+const defaultPublicBaseURL = "https://reflecto.co.in"
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type emailTemplates struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// EmailRenderer renders the email templates, parsed once up front. See the
+// templates package for the expected layout of the file system.
+type EmailRenderer struct {
+	// emails is keyed by locale, then by email name.
+	emails map[string]map[string]emailTemplates
+}
+
+func NewEmailRenderer(fsys fs.FS, publicBaseURL string) (*EmailRenderer, error) {
+	publicBaseURL = strings.TrimRight(publicBaseURL, "/")
+	funcs := map[string]interface{}{
+		"appURL": func(p string) string { return publicBaseURL + p },
+		"year":   func() int { return time.Now().Year() },
+		"signed": func(n int) string { return fmt.Sprintf("%+d", n) },
+	}
+
+	entries, err := fs.ReadDir(fsys, "email")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list email templates: %w", err)
+	}
+
+	r := &EmailRenderer{emails: make(map[string]map[string]emailTemplates)}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "layouts" {
+			continue
+		}
+		locale := entry.Name()
+		dir := path.Join("email", locale)
+		localeStrings := path.Join(dir, "strings.tmpl")
+
+		pages, err := fs.Glob(fsys, path.Join(dir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+
+		r.emails[locale] = make(map[string]emailTemplates)
+		for _, page := range pages {
+			name := strings.TrimSuffix(path.Base(page), ".html")
+			textPage := path.Join(dir, name+".txt")
+
+			html, err := htmltemplate.New("base.html").Funcs(htmltemplate.FuncMap(funcs)).
+				ParseFS(fsys, "email/layouts/base.html", localeStrings, page)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", page, err)
+			}
+			text, err := texttemplate.New("base.txt").Funcs(texttemplate.FuncMap(funcs)).
+				ParseFS(fsys, "email/layouts/base.txt", localeStrings, textPage)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", textPage, err)
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("%s does not define a subject", textPage)
+			}
+
+			r.emails[locale][name] = emailTemplates{html: html, text: text}
+		}
+	}
+
+	if len(r.emails[DefaultLocale]) == 0 {
+		return nil, fmt.Errorf("no %q email templates found", DefaultLocale)
+	}
+	return r, nil
+}
+
+// Locales lists every locale with at least one email, sorted.
+func (r *EmailRenderer) Locales() []string {
+	locales := make([]string, 0, len(r.emails))
+	for locale := range r.emails {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Names lists every email, sorted. Every email exists in DefaultLocale.
+func (r *EmailRenderer) Names() []string {
+	names := make([]string, 0, len(r.emails[DefaultLocale]))
+	for name := range r.emails[DefaultLocale] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render renders email name in the closest available match for locale: the
+// exact locale, then its language ("pt-br" falls back to "pt"), then
+// DefaultLocale.
+func (r *EmailRenderer) Render(name, locale string, data interface{}) (*RenderedEmail, error) {
+	tmpl, ok := r.lookup(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "base.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s.html: %w", name, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "base.txt", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s.txt: %w", name, err)
+	}
+
+	return &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+func (r *EmailRenderer) lookup(name, locale string) (emailTemplates, bool) {
+	locale, _ = NormalizeLocale(locale)
+	candidates := []string{locale}
+	if lang, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, lang)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, candidate := range candidates {
+		if tmpl, ok := r.emails[candidate][name]; ok {
+			return tmpl, true
+		}
+	}
+	return emailTemplates{}, false
+}
+
+// NormalizeLocale lower-cases a BCP 47 style locale ("en_US" becomes "en-us")
+// and reports whether it looks valid.
+func NormalizeLocale(locale string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	return locale, localePattern.MatchString(locale)
+}
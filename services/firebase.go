@@ -2,117 +2,95 @@ package services
 
 import (
 	"context"
-	"database/sql"
+	"fmt"
 	"log"
-	"sync"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	"google.golang.org/api/option"
 )
 
-var (
-	messagingClient *messaging.Client
-	once            sync.Once
-	initError       error
-)
-
-func InitFirebase(credentialsPath string) error {
-	once.Do(func() {
-		ctx := context.Background()
-
-		log.Printf("[FCM] Initializing Firebase with credentials: %s", credentialsPath)
-
-		opt := option.WithCredentialsFile(credentialsPath)
-		app, err := firebase.NewApp(ctx, nil, opt)
-		if err != nil {
-			initError = err
-			log.Printf("[FCM][ERROR] Failed to init Firebase app: %v", err)
-			return
-		}
-
-		messagingClient, err = app.Messaging(ctx)
-		if err != nil {
-			initError = err
-			log.Printf("[FCM][ERROR] Failed to get messaging client: %v", err)
-			return
-		}
-
-		log.Println("[FCM] Firebase Messaging client initialized successfully")
-	})
+// FCM accepts at most this many tokens in one multicast request.
+const fcmMulticastLimit = 500
 
-	return initError
+// FCMSender delivers pushes through Firebase Cloud Messaging.
+type FCMSender struct {
+	client *messaging.Client
 }
 
-func GetMessagingClient() (*messaging.Client, error) {
-	if messagingClient == nil {
-		log.Printf("[FCM][ERROR] Messaging client is nil (initError=%v)", initError)
-		return nil, initError
-	}
-	return messagingClient, nil
-}
+func NewFCMSender(ctx context.Context, credentialsPath string) (*FCMSender, error) {
+	log.Printf("[FCM] Initializing Firebase with credentials: %s", credentialsPath)
 
-func SendNotification(deviceToken, title, body string, data map[string]string) error {
-	client, err := GetMessagingClient()
+	opt := option.WithCredentialsFile(credentialsPath)
+	app, err := firebase.NewApp(ctx, nil, opt)
 	if err != nil {
-		return err
-	}
-
-	message := &messaging.Message{
-		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
-		},
-		Data:  data,
-		Token: deviceToken,
+		return nil, fmt.Errorf("failed to init Firebase app: %w", err)
 	}
 
-	response, err := client.Send(context.Background(), message)
+	client, err := app.Messaging(ctx)
 	if err != nil {
-		log.Printf("Error sending notification: %v", err)
-		return err
+		return nil, fmt.Errorf("failed to get messaging client: %w", err)
 	}
 
-	log.Printf("Successfully sent message: %s", response)
-	return nil
+	log.Println("[FCM] Firebase Messaging client initialized successfully")
+	return &FCMSender{client: client}, nil
 }
 
-func SendMultipleNotifications(
-	db *sql.DB,
-	tokens []string,
-	title, body string,
-	data map[string]string,
-) (int, int, error) {
+func (s *FCMSender) Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error) {
+	var report PushReport
 
-	client, err := GetMessagingClient()
-	if err != nil {
-		return 0, 0, err
+	for start := 0; start < len(devices); start += fcmMulticastLimit {
+		end := min(start+fcmMulticastLimit, len(devices))
+
+		tokens := make([]string, 0, end-start)
+		for _, d := range devices[start:end] {
+			tokens = append(tokens, d.Token)
+		}
+
+		batch, err := s.sendMulticast(ctx, tokens, msg)
+		if err != nil {
+			return report, err
+		}
+		report.merge(batch)
 	}
 
+	return report, nil
+}
+
+func (s *FCMSender) sendMulticast(ctx context.Context, tokens []string, msg PushMessage) (PushReport, error) {
 	log.Printf(
 		"[FCM] Sending multicast | tokens=%d title=%q",
 		len(tokens),
-		title,
+		msg.Title,
 	)
 
-	// Log first token (helps debugging project mismatch)
-	if len(tokens) > 0 {
-		log.Printf("[FCM] Sample token: %s...", tokens[0][:min(10, len(tokens[0]))])
-	}
-
 	message := &messaging.MulticastMessage{
 		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
+			Title: msg.Title,
+			Body:  msg.Body,
 		},
-		Data:   data,
+		Data:   msg.Data,
 		Tokens: tokens,
 	}
 
-	response, err := client.SendEachForMulticast(context.Background(), message)
+	if msg.CollapseKey != "" {
+		message.Android = &messaging.AndroidConfig{
+			CollapseKey: msg.CollapseKey,
+			Notification: &messaging.AndroidNotification{
+				Tag: msg.CollapseKey,
+			},
+		}
+		message.APNS = &messaging.APNSConfig{
+			Headers: map[string]string{
+				"apns-collapse-id": msg.CollapseKey,
+			},
+		}
+	}
+
+	response, err := s.client.SendEachForMulticast(ctx, message)
 	if err != nil {
 		log.Printf("[FCM][ERROR] Multicast send failed entirely: %v", err)
-		return 0, 0, err
+		return PushReport{}, err
 	}
 
 	log.Printf(
@@ -121,45 +99,22 @@ func SendMultipleNotifications(
 		response.FailureCount,
 	)
 
-	// 🔥 PER-TOKEN ERROR LOGGING (CRITICAL)
+	report := PushReport{
+		SuccessCount: response.SuccessCount,
+		FailureCount: response.FailureCount,
+	}
+
 	for i, resp := range response.Responses {
 		if resp.Success {
 			continue
 		}
 
-		token := tokens[i]
-		log.Printf(
-			"[FCM][TOKEN ERROR] token=%s error=%v",
-			token,
-			resp.Error,
-		)
+		log.Printf("[FCM][TOKEN ERROR] token=%s error=%v", tokens[i], resp.Error)
 
-		// Detect dead tokens explicitly
 		if messaging.IsUnregistered(resp.Error) {
-			log.Printf("[FCM] Deleting dead token: %s", token)
-
-			_, err := db.Exec(`
-					DELETE FROM fcm_tokens
-					WHERE token = $1
-				`, token)
-
-			if err != nil {
-				log.Printf("[FCM][ERROR] Failed to delete token %s: %v", token, err)
-			}
+			report.InvalidTokens = append(report.InvalidTokens, tokens[i])
 		}
-
 	}
 
-	return response.SuccessCount, response.FailureCount, nil
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func SendNotificationToUser(db interface{}, userID int, title, body string, data map[string]string) error {
-	return nil
+	return report, nil
 }
@@ -1,16 +1,19 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"os"
-	"strings"
 
-	"github.com/wneessen/go-mail"
+	"masterboxer.com/project-micro-journal/templates"
 )
 
 type MailService struct {
-	client *mail.Client
-	from   string
+	transport     MailTransport
+	from          string
+	publicBaseURL string
+	renderer      *EmailRenderer
 }
 
 type Config struct {
@@ -19,66 +22,125 @@ type Config struct {
 	Username string
 	Password string
 	From     string
+
+	// PublicBaseURL is the web app's address, used for links in emails.
+	PublicBaseURL string
+
+	// Transport selects how mail leaves: MailTransportSMTP (the default) or
+	// MailTransportMaildir, which writes to MaildirPath instead.
+	Transport   string
+	MaildirPath string
+}
+
+// ConfigFromEnv reads the SMTP settings from SMTP_HOST, SMTP_USER, SMTP_PASS
+// and SMTP_FROM, the web app address from PUBLIC_BASE_URL, and the transport
+// from MAIL_TRANSPORT and MAILDIR_PATH.
+func ConfigFromEnv() Config {
+	return Config{
+		Host:          os.Getenv("SMTP_HOST"),
+		Port:          587,
+		Username:      os.Getenv("SMTP_USER"),
+		Password:      os.Getenv("SMTP_PASS"),
+		From:          os.Getenv("SMTP_FROM"),
+		PublicBaseURL: PublicBaseURLFromEnv(),
+		Transport:     os.Getenv("MAIL_TRANSPORT"),
+		MaildirPath:   os.Getenv("MAILDIR_PATH"),
+	}
+}
+
+func PublicBaseURLFromEnv() string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return base
+	}
+	return defaultPublicBaseURL
 }
 
 func NewMailService(cfg Config) (*MailService, error) {
-	client, err := mail.NewClient(
-		cfg.Host,
-		mail.WithPort(cfg.Port),
-		mail.WithSMTPAuth(mail.SMTPAuthAutoDiscover),
-		mail.WithUsername(cfg.Username),
-		mail.WithPassword(cfg.Password),
-		mail.WithTLSPolicy(mail.TLSMandatory),
-	)
+	transport, err := NewMailTransport(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create mail client: %w", err)
+		return nil, err
 	}
-
-	return &MailService{
-		client: client,
-		from:   cfg.From,
-	}, nil
+	return NewMailServiceWithTransport(cfg, transport)
 }
 
-func (m *MailService) SendMail(to, subject, textBody, htmlBody string) error {
-	msg := mail.NewMsg()
-	if err := msg.From(m.from); err != nil {
-		return err
+// NewMailServiceWithTransport is NewMailService with the transport supplied
+// by the caller, e.g. a CaptureTransport.
+func NewMailServiceWithTransport(cfg Config, transport MailTransport) (*MailService, error) {
+	if cfg.PublicBaseURL == "" {
+		cfg.PublicBaseURL = defaultPublicBaseURL
 	}
-	if err := msg.To(to); err != nil {
-		return err
+
+	renderer, err := NewEmailRenderer(templates.Email, cfg.PublicBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email templates: %w", err)
 	}
-	msg.Subject(subject)
-	msg.SetBodyString(mail.TypeTextPlain, textBody)
-	msg.AddAlternativeString(mail.TypeTextHTML, htmlBody)
 
-	return m.client.DialAndSend(msg)
+	return &MailService{
+		transport:     transport,
+		from:          cfg.From,
+		publicBaseURL: cfg.PublicBaseURL,
+		renderer:      renderer,
+	}, nil
 }
 
-func (m *MailService) SendPasswordResetEmail(to, token string) error {
-	link := fmt.Sprintf("https://reflecto.co.in/reset-password?token=%s", token)
+// TemplatedMail is an email rendered from one of the embedded templates in
+// the recipient's locale.
+type TemplatedMail struct {
+	To       string
+	Locale   string
+	Template string
+	Data     interface{}
+
+	// UnsubscribeURL, when set, is advertised through the List-Unsubscribe
+	// headers so mail clients can offer one-click unsubscribe (RFC 8058).
+	UnsubscribeURL string
+}
 
-	htmlBytes, err := os.ReadFile("templates/reset-password.html")
+// Compose renders tm into a message ready for Deliver.
+func (m *MailService) Compose(tm TemplatedMail) (OutgoingMail, error) {
+	email, err := m.renderer.Render(tm.Template, tm.Locale, tm.Data)
 	if err != nil {
-		return fmt.Errorf("failed to read template: %w", err)
+		return OutgoingMail{}, err
 	}
 
-	htmlBody := strings.ReplaceAll(string(htmlBytes), "{{RESET_LINK}}", link)
-	textBody := fmt.Sprintf("Reset your Reflecto password:\n%s\n\nExpires in 15 minutes.", link)
-
-	return m.SendMail(to, "Reset your password — Reflecto", textBody, htmlBody)
+	return OutgoingMail{
+		From:           m.from,
+		To:             tm.To,
+		Subject:        email.Subject,
+		Text:           email.Text,
+		HTML:           email.HTML,
+		UnsubscribeURL: tm.UnsubscribeURL,
+	}, nil
 }
 
-func (m *MailService) SendVerificationEmail(to, token string) error {
-	link := fmt.Sprintf("https://reflecto.co.in/verify-email?token=%s", token)
-
-	htmlBytes, err := os.ReadFile("templates/verify-email.html")
-	if err != nil {
-		return fmt.Errorf("failed to read template: %w", err)
+// Deliver hands msg to the transport. It blocks for as long as the transport
+// does, so request handlers should queue mail rather than call it directly.
+func (m *MailService) Deliver(ctx context.Context, msg OutgoingMail) error {
+	if msg.From == "" {
+		msg.From = m.from
 	}
+	return m.transport.Send(ctx, msg)
+}
 
-	htmlBody := strings.ReplaceAll(string(htmlBytes), "{{VERIFY_LINK}}", link)
-	textBody := fmt.Sprintf("Welcome to Reflecto! Verify your email:\n%s", link)
+func (m *MailService) PasswordResetMail(to, locale, token string) TemplatedMail {
+	return TemplatedMail{
+		To:       to,
+		Locale:   locale,
+		Template: "reset-password",
+		Data: map[string]interface{}{
+			"Link":             m.publicBaseURL + "/reset-password?token=" + url.QueryEscape(token),
+			"ExpiresInMinutes": 15,
+		},
+	}
+}
 
-	return m.SendMail(to, "Verify your email — Reflecto", textBody, htmlBody)
+func (m *MailService) VerificationMail(to, locale, token string) TemplatedMail {
+	return TemplatedMail{
+		To:       to,
+		Locale:   locale,
+		Template: "verify-email",
+		Data: map[string]interface{}{
+			"Link": m.publicBaseURL + "/verify-email?token=" + url.QueryEscape(token),
+		},
+	}
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+const (
+	MailTransportSMTP    = "smtp"
+	MailTransportMaildir = "maildir"
+)
+
+// OutgoingMail is a fully rendered email, ready to hand to a MailTransport.
+type OutgoingMail struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+
+	// UnsubscribeURL, when set, is advertised through the List-Unsubscribe
+	// headers so mail clients can offer one-click unsubscribe (RFC 8058).
+	UnsubscribeURL string
+}
+
+// MailTransport delivers a rendered email. Errors wrapped in
+// PermanentMailError mean the receiving side refused the message for good;
+// anything else is worth retrying.
+type MailTransport interface {
+	Send(ctx context.Context, m OutgoingMail) error
+}
+
+// PermanentMailError is a delivery the receiving server rejected outright,
+// such as an unknown mailbox. Retrying it won't help.
+type PermanentMailError struct {
+	Code int
+	Err  error
+}
+
+func (e *PermanentMailError) Error() string {
+	return fmt.Sprintf("permanent failure (%d): %v", e.Code, e.Err)
+}
+
+func (e *PermanentMailError) Unwrap() error { return e.Err }
+
+func IsPermanentMailError(err error) bool {
+	var permanent *PermanentMailError
+	return errors.As(err, &permanent)
+}
+
+func buildMsg(m OutgoingMail) (*mail.Msg, error) {
+	msg := mail.NewMsg()
+	if err := msg.From(m.From); err != nil {
+		return nil, err
+	}
+	if err := msg.To(m.To); err != nil {
+		return nil, err
+	}
+	msg.Subject(m.Subject)
+	if m.UnsubscribeURL != "" {
+		msg.SetGenHeader(mail.HeaderListUnsubscribe, "<"+m.UnsubscribeURL+">")
+		msg.SetGenHeader(mail.HeaderListUnsubscribePost, "List-Unsubscribe=One-Click")
+	}
+	msg.SetBodyString(mail.TypeTextPlain, m.Text)
+	msg.AddAlternativeString(mail.TypeTextHTML, m.HTML)
+	return msg, nil
+}
+
+// SMTPTransport sends through an SMTP relay.
+type SMTPTransport struct {
+	client *mail.Client
+}
+
+func NewSMTPTransport(cfg Config) (*SMTPTransport, error) {
+	client, err := mail.NewClient(
+		cfg.Host,
+		mail.WithPort(cfg.Port),
+		mail.WithSMTPAuth(mail.SMTPAuthAutoDiscover),
+		mail.WithUsername(cfg.Username),
+		mail.WithPassword(cfg.Password),
+		mail.WithTLSPolicy(mail.TLSMandatory),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mail client: %w", err)
+	}
+	return &SMTPTransport{client: client}, nil
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, m OutgoingMail) error {
+	msg, err := buildMsg(m)
+	if err != nil {
+		// A malformed address will never become deliverable.
+		return &PermanentMailError{Err: err}
+	}
+
+	err = t.client.DialAndSendWithContext(ctx, msg)
+	var sendErr *mail.SendError
+	if errors.As(err, &sendErr) && sendErr.ErrorCode() >= 500 && sendErr.ErrorCode() < 600 {
+		return &PermanentMailError{Code: sendErr.ErrorCode(), Err: err}
+	}
+	return err
+}
+
+// MaildirTransport writes each email into a Maildir on disk instead of
+// sending it, so development setups can read mail with any Maildir-aware
+// client (or just open the files).
+type MaildirTransport struct {
+	dir      string
+	hostname string
+	seq      atomic.Uint64
+}
+
+func NewMaildirTransport(dir string) (*MaildirTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	// Maildir reserves "/" and ":" in file names.
+	hostname = strings.NewReplacer("/", "_", ":", "_").Replace(hostname)
+	return &MaildirTransport{dir: dir, hostname: hostname}, nil
+}
+
+func (t *MaildirTransport) Send(ctx context.Context, m OutgoingMail) error {
+	msg, err := buildMsg(m)
+	if err != nil {
+		return &PermanentMailError{Err: err}
+	}
+	msg.SetDate()
+	msg.SetMessageID()
+
+	// Deliver into tmp/ and rename into new/, so readers never see a
+	// half-written message.
+	name := fmt.Sprintf("%d.P%d_%d.%s", time.Now().UnixNano(), os.Getpid(), t.seq.Add(1), t.hostname)
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	if err := msg.WriteToFile(tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(t.dir, "new", name))
+}
+
+// CaptureTransport records every email instead of delivering it. Addresses
+// passed to Reject fail permanently, like a mailbox that doesn't exist, and
+// addresses passed to FailNext fail temporarily, like a busy server.
+type CaptureTransport struct {
+	mu       sync.Mutex
+	sent     []OutgoingMail
+	rejected map[string]bool
+	failing  map[string]int
+}
+
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{rejected: make(map[string]bool), failing: make(map[string]int)}
+}
+
+func (t *CaptureTransport) Send(ctx context.Context, m OutgoingMail) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	to := strings.ToLower(m.To)
+	if t.rejected[to] {
+		return &PermanentMailError{Code: 550, Err: fmt.Errorf("mailbox %s does not exist", m.To)}
+	}
+	if t.failing[to] > 0 {
+		t.failing[to]--
+		return fmt.Errorf("mail server busy, try %s again later", m.To)
+	}
+	t.sent = append(t.sent, m)
+	return nil
+}
+
+func (t *CaptureTransport) Reject(address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rejected[strings.ToLower(address)] = true
+}
+
+// FailNext makes the next n sends to address fail with a temporary error.
+func (t *CaptureTransport) FailNext(address string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failing[strings.ToLower(address)] = n
+}
+
+// Sent returns a copy of everything sent so far.
+func (t *CaptureTransport) Sent() []OutgoingMail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]OutgoingMail(nil), t.sent...)
+}
+
+func (t *CaptureTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = nil
+}
+
+// NewMailTransport builds the transport named by cfg.Transport, SMTP unless
+// configured otherwise.
+func NewMailTransport(cfg Config) (MailTransport, error) {
+	switch cfg.Transport {
+	case "", MailTransportSMTP:
+		return NewSMTPTransport(cfg)
+	case MailTransportMaildir:
+		if cfg.MaildirPath == "" {
+			return nil, errMissingConfig("MAILDIR_PATH")
+		}
+		return NewMaildirTransport(cfg.MaildirPath)
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+	}
+}
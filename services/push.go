@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Push providers a device token can belong to.
+const (
+	ProviderFCM     = "fcm"
+	ProviderAPNs    = "apns"
+	ProviderWebPush = "webpush"
+)
+
+// PushDevice is one registered device. For FCM and APNs Token is the device
+// token; for Web Push it is the browser's PushSubscription serialised as JSON.
+type PushDevice struct {
+	Token    string
+	Provider string
+}
+
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+
+	// CollapseKey, when set, makes a newer message replace an older one with
+	// the same key on the device.
+	CollapseKey string
+}
+
+// PushReport summarises a send. InvalidTokens lists tokens the provider says
+// will never work again; callers should forget them.
+type PushReport struct {
+	SuccessCount  int
+	FailureCount  int
+	InvalidTokens []string
+}
+
+func (r *PushReport) merge(other PushReport) {
+	r.SuccessCount += other.SuccessCount
+	r.FailureCount += other.FailureCount
+	r.InvalidTokens = append(r.InvalidTokens, other.InvalidTokens...)
+}
+
+type PushSender interface {
+	Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error)
+}
+
+// PushRouter hands each device to the sender registered for its provider.
+// Devices whose provider has no sender count as failures.
+type PushRouter struct {
+	senders map[string]PushSender
+}
+
+func NewPushRouter(senders map[string]PushSender) *PushRouter {
+	return &PushRouter{senders: senders}
+}
+
+func (r *PushRouter) Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error) {
+	byProvider := make(map[string][]PushDevice)
+	for _, d := range devices {
+		byProvider[d.Provider] = append(byProvider[d.Provider], d)
+	}
+
+	var report PushReport
+	var lastErr error
+	for provider, group := range byProvider {
+		sender, ok := r.senders[provider]
+		if !ok {
+			log.Printf("[Push] No sender configured for provider %q, dropping %d device(s)", provider, len(group))
+			report.FailureCount += len(group)
+			continue
+		}
+
+		providerReport, err := sender.Send(ctx, group, msg)
+		if err != nil {
+			log.Printf("[Push] %s send failed: %v", provider, err)
+			report.FailureCount += len(group)
+			lastErr = err
+			continue
+		}
+		report.merge(providerReport)
+	}
+
+	if report.SuccessCount == 0 && lastErr != nil {
+		return report, lastErr
+	}
+	return report, nil
+}
+
+// VAPIDPublicKey returns the Web Push application server key, or "" when Web
+// Push isn't configured.
+func (r *PushRouter) VAPIDPublicKey() string {
+	if webPush, ok := r.senders[ProviderWebPush].(*WebPushSender); ok {
+		return webPush.VAPIDPublicKey()
+	}
+	return ""
+}
+
+// NewPushSenderFromEnv builds a PushRouter with every provider that has
+// credentials available. FCM uses the service account at firebaseCredentials;
+// Web Push needs VAPID_PUBLIC_KEY, VAPID_PRIVATE_KEY and VAPID_SUBJECT; APNs
+// needs APNS_KEY_PATH, APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC.
+func NewPushSenderFromEnv(ctx context.Context, firebaseCredentials string) *PushRouter {
+	senders := make(map[string]PushSender)
+
+	if fcm, err := NewFCMSender(ctx, firebaseCredentials); err != nil {
+		log.Printf("Warning: FCM push disabled: %v", err)
+	} else {
+		senders[ProviderFCM] = fcm
+	}
+
+	if os.Getenv("VAPID_PRIVATE_KEY") != "" {
+		webPush, err := NewWebPushSender(WebPushConfig{
+			PublicKey:  os.Getenv("VAPID_PUBLIC_KEY"),
+			PrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+			Subject:    os.Getenv("VAPID_SUBJECT"),
+		})
+		if err != nil {
+			log.Printf("Warning: Web Push disabled: %v", err)
+		} else {
+			senders[ProviderWebPush] = webPush
+		}
+	}
+
+	if os.Getenv("APNS_KEY_PATH") != "" {
+		apns, err := NewAPNsSender(APNsConfig{
+			KeyPath:    os.Getenv("APNS_KEY_PATH"),
+			KeyID:      os.Getenv("APNS_KEY_ID"),
+			TeamID:     os.Getenv("APNS_TEAM_ID"),
+			Topic:      os.Getenv("APNS_TOPIC"),
+			Production: os.Getenv("APNS_PRODUCTION") == "true",
+		})
+		if err != nil {
+			log.Printf("Warning: APNs push disabled: %v", err)
+		} else {
+			senders[ProviderAPNs] = apns
+		}
+	}
+
+	return NewPushRouter(senders)
+}
+
+func IsPushProvider(provider string) bool {
+	switch provider {
+	case ProviderFCM, ProviderAPNs, ProviderWebPush:
+		return true
+	}
+	return false
+}
+
+func errMissingConfig(field string) error {
+	return fmt.Errorf("%s is not set", field)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// SentPush is one message recorded by FakePushSender.
+type SentPush struct {
+	Devices []PushDevice
+	Message PushMessage
+}
+
+// FakePushSender records every message instead of delivering it, so
+// notification flows can be exercised without any push provider. Tokens
+// added with MarkInvalid are reported back as invalid, like a provider would
+// for an uninstalled app.
+type FakePushSender struct {
+	mu      sync.Mutex
+	sent    []SentPush
+	invalid map[string]bool
+}
+
+func NewFakePushSender() *FakePushSender {
+	return &FakePushSender{invalid: make(map[string]bool)}
+}
+
+func (f *FakePushSender) Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, SentPush{
+		Devices: append([]PushDevice(nil), devices...),
+		Message: msg,
+	})
+
+	var report PushReport
+	for _, d := range devices {
+		if f.invalid[d.Token] {
+			report.FailureCount++
+			report.InvalidTokens = append(report.InvalidTokens, d.Token)
+			continue
+		}
+		report.SuccessCount++
+	}
+	return report, nil
+}
+
+func (f *FakePushSender) MarkInvalid(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invalid[token] = true
+}
+
+// Sent returns a copy of everything sent so far.
+func (f *FakePushSender) Sent() []SentPush {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SentPush(nil), f.sent...)
+}
+
+func (f *FakePushSender) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = nil
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	webPushTTL         = 24 * time.Hour
+	webPushRecordSize  = 4096
+	webPushJWTLifetime = 12 * time.Hour
+)
+
+type WebPushConfig struct {
+	// PublicKey and PrivateKey are the VAPID key pair, base64url encoded as
+	// produced by the usual web-push key generators.
+	PublicKey  string
+	PrivateKey string
+	// Subject is a mailto: or https: contact for the push service operator.
+	Subject string
+}
+
+// WebPushSender delivers pushes to browsers using the Web Push protocol
+// (RFC 8030) with VAPID authentication (RFC 8292) and aes128gcm payload
+// encryption (RFC 8291).
+type WebPushSender struct {
+	publicKey  string
+	privateKey *ecdsa.PrivateKey
+	subject    string
+	client     *http.Client
+}
+
+// webPushSubscription is the JSON a browser's PushSubscription serialises to;
+// it is what the client registers as its token.
+type webPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+func NewWebPushSender(cfg WebPushConfig) (*WebPushSender, error) {
+	if cfg.PrivateKey == "" {
+		return nil, errMissingConfig("VAPID_PRIVATE_KEY")
+	}
+	if cfg.Subject == "" {
+		return nil, errMissingConfig("VAPID_SUBJECT")
+	}
+
+	raw, err := decodeBase64URL(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	publicKey := cfg.PublicKey
+	if publicKey == "" {
+		ecdhKey, err := privateKey.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		publicKey = base64.RawURLEncoding.EncodeToString(ecdhKey.PublicKey().Bytes())
+	}
+
+	return &WebPushSender{
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		subject:    cfg.Subject,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// VAPIDPublicKey is the VAPID application server key browsers pass to
+// pushManager.subscribe.
+func (s *WebPushSender) VAPIDPublicKey() string {
+	return s.publicKey
+}
+
+func (s *WebPushSender) Send(ctx context.Context, devices []PushDevice, msg PushMessage) (PushReport, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"data":  msg.Data,
+		"tag":   msg.CollapseKey,
+	})
+	if err != nil {
+		return PushReport{}, err
+	}
+
+	var report PushReport
+	for _, device := range devices {
+		invalid, err := s.sendOne(ctx, device.Token, payload, msg.CollapseKey)
+		if err != nil {
+			log.Printf("[WebPush][TOKEN ERROR] error=%v", err)
+			report.FailureCount++
+			if invalid {
+				report.InvalidTokens = append(report.InvalidTokens, device.Token)
+			}
+			continue
+		}
+		report.SuccessCount++
+	}
+
+	log.Printf("[WebPush] Send result | success=%d failure=%d", report.SuccessCount, report.FailureCount)
+	return report, nil
+}
+
+// sendOne pushes payload to a single subscription. invalid reports whether
+// the subscription is gone for good.
+func (s *WebPushSender) sendOne(ctx context.Context, token string, payload []byte, collapseKey string) (invalid bool, err error) {
+	var sub webPushSubscription
+	if err := json.Unmarshal([]byte(token), &sub); err != nil || sub.Endpoint == "" {
+		return true, fmt.Errorf("malformed subscription")
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" {
+		return true, fmt.Errorf("invalid endpoint %q", sub.Endpoint)
+	}
+
+	body, err := encryptWebPushPayload(sub, payload)
+	if err != nil {
+		return true, err
+	}
+
+	vapidToken, err := s.vapidJWT(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", "vapid t="+vapidToken+", k="+s.publicKey)
+	if collapseKey != "" {
+		req.Header.Set("Topic", webPushTopic(collapseKey))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	gone := resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+	return gone, fmt.Errorf("push service returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+func (s *WebPushSender) vapidJWT(audience string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": audience,
+		"exp": time.Now().Add(webPushJWTLifetime).Unix(),
+		"sub": s.subject,
+	})
+	return token.SignedString(s.privateKey)
+}
+
+// webPushTopic turns a collapse key into a valid Topic header, which is
+// limited to 32 URL-safe base64 characters.
+func webPushTopic(collapseKey string) string {
+	sum := sha256.Sum256([]byte(collapseKey))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:32]
+}
+
+// encryptWebPushPayload encrypts payload for the subscription as a single
+// aes128gcm record (RFC 8291, section 3).
+func encryptWebPushPayload(sub webPushSubscription, payload []byte) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicBytes := asPrivate.PublicKey().Bytes()
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublicBytes)
+	ikm, err := hkdf.Key(sha256.New, ecdhSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record, so the padding delimiter is 0x02 (last record).
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > webPushRecordSize {
+		return nil, fmt.Errorf("payload too large for web push")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublicBytes))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublicBytes)))
+	header = append(header, asPublicBytes...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
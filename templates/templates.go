@@ -0,0 +1,12 @@
+// Package templates embeds the email templates into the binary.
+//
+// Layouts shared by every email live in email/layouts. Each locale has its
+// own directory under email/ holding strings.tmpl, with the layout's
+// translated labels, and a NAME.html and NAME.txt per email. NAME.txt also
+// defines the "subject" template.
+package templates
+
+import "embed"
+
+//go:embed email
+var Email embed.FS